@@ -2,18 +2,34 @@ package builder
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type Builder struct {
 	ConfigMaps              []BuilderConfigMap
+	Secrets                 []BuilderSecret
 	DeploymentOrStatefulset []BuilderDeploymentStatefulSet
 	StorageConfig           []BuilderStorageConfig
 	Service                 []BuilderService
 	NetworkPolicy           []BuilderNetworkPolicy
+	Ingress                 []BuilderIngress
+	Route                   []BuilderRoute
+	PodDisruptionBudget     []BuilderPodDisruptionBudget
+	HPA                     []BuilderHPA
+	ServiceAccount          []BuilderServiceAccount
+	Role                    []BuilderRole
+	RoleBinding             []BuilderRoleBinding
+	Job                     []BuilderJob
+	CronJob                 []BuilderCronJob
+	Unstructured            []BuilderUnstructured
+	UnstructuredKinds       []schema.GroupVersionKind
+	Resources               []Resource
 	Recorder                BuilderRecorder
 	Context                 BuilderContext
 	Store                   InternalStore
+	Status                  BuilderStatus
+	Phases                  BuilderPhases
 }
 
 type CommonBuilder struct {
@@ -25,6 +41,32 @@ type CommonBuilder struct {
 	CurrentState client.Object
 	ObjectList   client.ObjectList
 	Labels       map[string]string
+	// ServerSideApply, when set, makes CreateOrUpdate send the desired state
+	// as a server-side apply patch instead of a full update.
+	ServerSideApply *ServerSideApply
+	// DetectDrift compares the live object with the desired state even when the
+	// hash is unchanged, so edits made outside the operator are reconciled back.
+	DetectDrift bool
+	// ImmutableFieldPolicy decides how updates changing immutable fields are handled,
+	// defaults to failing with an ImmutableFieldError.
+	ImmutableFieldPolicy ImmutableFieldPolicy
+	// DeletePropagation is sent with Delete when set, the api server default applies otherwise.
+	DeletePropagation *metav1.DeletionPropagation
+	// beforeWrite adjusts the desired state right before it is written, current is nil
+	// when the object is created. Changes made by it are not part of the hash.
+	beforeWrite func(desired, current client.Object)
+	// autoscaled leaves spec.replicas out of server-side apply patches once the object exists,
+	// see handOverReplicas.
+	autoscaled bool
+}
+
+// ServerSideApply holds the field manager settings used when applying objects.
+type ServerSideApply struct {
+	// FieldManager is the name recorded in managedFields, defaults to the
+	// recorder controller name.
+	FieldManager string
+	// ForceOwnership takes over fields owned by other managers on conflict.
+	ForceOwnership bool
 }
 
 type ToBuilder func(opts *Builder)
@@ -34,5 +76,6 @@ func NewBuilder(opts ...ToBuilder) *Builder {
 	for _, opt := range opts {
 		opt(builder)
 	}
+	builder.Recorder.scheme = schemeOf(builder.Store.Client)
 	return builder
 }
@@ -0,0 +1,343 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The progress of a canary rollout is persisted on the statefulset, so it survives operator restarts.
+const (
+	canaryRevisionAnnotation     = "operator-runtime.datainfra.io/canary-revision"
+	canaryStepAnnotation         = "operator-runtime.datainfra.io/canary-step"
+	canaryHealthySinceAnnotation = "operator-runtime.datainfra.io/canary-healthy-since"
+	canaryStepStartedAnnotation  = "operator-runtime.datainfra.io/canary-step-started"
+	// CanaryPausedAnnotation holds the reason a canary rollout paused, removing it from the
+	// statefulset resumes the rollout.
+	CanaryPausedAnnotation = "operator-runtime.datainfra.io/canary-paused"
+
+	canaryCondition = "Canary"
+)
+
+// CanaryStrategy rolls a new pod template out to a statefulset through decreasing partitions, only
+// the pods with an ordinal greater or equal to the partition are updated. A final step to
+// partition 0 follows the listed partitions.
+type CanaryStrategy struct {
+	// Partitions of the steps in rollout order, e.g. [replicas-1, replicas/2].
+	Partitions []int32
+	// SoakTime is how long a step must stay healthy before the next one starts.
+	SoakTime time.Duration
+	// HealthGate is checked once the pods of a step are ready, the step soaks once it passes.
+	HealthGate HealthGate
+	// HealthGateTimeout pauses the rollout when a step has not become healthy this long after it
+	// started, zero waits forever. Pods of the step which fail to start always pause the rollout.
+	HealthGateTimeout time.Duration
+}
+
+type canaryState struct {
+	Revision     string
+	Step         int
+	HealthySince time.Time
+	StepStarted  time.Time
+	Paused       string
+}
+
+// applyCanary sets the partition of the statefulset for the current step of the canary rollout and
+// advances the rollout once the step has been healthy for the soak time. A new pod template starts
+// a new rollout from the first step, statefulsets which are created or already run the desired
+// template are rolled out at once. The state is patched onto the live statefulset, it is not part
+// of the desired state so it does not change the hash, see keepCanaryState. It returns true while
+// the rollout progresses.
+func (s *Builder) applyCanary(node BuilderDeploymentStatefulSet, desired *appsv1.StatefulSet) (bool, error) {
+
+	canary := node.Canary
+	if err := validatePartitions(canary.Partitions); err != nil {
+		return false, err
+	}
+
+	revision, err := specHash(desired.Spec.Template)
+	if err != nil {
+		return false, err
+	}
+
+	steps := len(canary.Partitions)
+	conditionType := canaryCondition + "." + desired.GetName()
+
+	current := &appsv1.StatefulSet{}
+	if err := node.Client.Get(s.Context.Context, *namespacedName(desired.GetName(), desired.GetNamespace()), current); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		return false, nil
+	}
+
+	state := canaryStateOf(current)
+	if state.Revision != revision {
+		live, err := isTemplateLive(desired, current)
+		if err != nil {
+			return false, err
+		}
+		// a statefulset adopted by the canary, or one whose template was rolled out already,
+		// has nothing left to roll out
+		if live {
+			state = canaryState{Revision: revision, Step: steps}
+		} else {
+			state = canaryState{Revision: revision}
+			s.Recorder.canaryEvent(node.CrObject, current, v1.EventTypeNormal, fmt.Sprintf("rollout of revision [%s] started", revision))
+		}
+	}
+
+	var waiting string
+	if state.Paused == "" && state.Step < steps {
+		if state.StepStarted.IsZero() {
+			state.StepStarted = time.Now().UTC()
+		}
+
+		healthy, reason, err := s.isCanaryStepHealthy(node, current, canary.Partitions[state.Step])
+		switch {
+		case err != nil:
+			state.Paused = err.Error()
+			state.HealthySince = time.Time{}
+		case !healthy:
+			state.HealthySince = time.Time{}
+			waiting = reason
+			if canary.HealthGateTimeout > 0 && time.Since(state.StepStarted) >= canary.HealthGateTimeout {
+				state.Paused = fmt.Sprintf("step [%d] did not become healthy within [%s]", state.Step, canary.HealthGateTimeout)
+				if reason != "" {
+					state.Paused = fmt.Sprintf("%s, %s", state.Paused, reason)
+				}
+			}
+		case state.HealthySince.IsZero():
+			state.HealthySince = time.Now().UTC()
+		case time.Since(state.HealthySince) >= canary.SoakTime:
+			state.Step++
+			state.HealthySince = time.Time{}
+			state.StepStarted = time.Now().UTC()
+			s.Recorder.canaryEvent(node.CrObject, current, v1.EventTypeNormal, fmt.Sprintf("rollout advanced to step [%d]", state.Step))
+		}
+
+		if state.Paused != "" {
+			s.Recorder.canaryEvent(node.CrObject, current, v1.EventTypeWarning, fmt.Sprintf("rollout paused at step [%d], %s", state.Step, state.Paused))
+		}
+	}
+
+	var partition int32
+	if state.Step < steps {
+		partition = canary.Partitions[state.Step]
+	}
+	if err := persistCanaryState(s.Context.Context, node.Client, current, state, partition); err != nil {
+		return false, err
+	}
+
+	switch {
+	case state.Paused != "":
+		s.setCondition(conditionType, metav1.ConditionFalse, "Paused", state.Paused)
+		return false, nil
+	case state.Step < steps:
+		message := fmt.Sprintf("Step [%d] of [%d], partition [%d]", state.Step+1, steps+1, partition)
+		if waiting != "" {
+			message = fmt.Sprintf("%s, %s", message, waiting)
+		}
+		s.setCondition(conditionType, metav1.ConditionUnknown, "Progressing", message)
+		return true, nil
+	default:
+		s.setCondition(conditionType, metav1.ConditionTrue, "Complete", fmt.Sprintf("Revision [%s] rolled out", revision))
+		return false, nil
+	}
+}
+
+// isCanaryStepHealthy reports whether the live statefulset runs the partition of the step with
+// every pod ready, followed by the health gate. A gate which does not pass yet is not an error,
+// its reason is returned instead. Pods of the step which fail to start are returned as an error.
+func (s *Builder) isCanaryStepHealthy(node BuilderDeploymentStatefulSet, current *appsv1.StatefulSet, partition int32) (bool, string, error) {
+
+	if err := statefulSetRolloutFailure(s.Context.Context, node.Client, current); err != nil {
+		return false, "", err
+	}
+
+	rollingUpdate := current.Spec.UpdateStrategy.RollingUpdate
+	if rollingUpdate == nil || rollingUpdate.Partition == nil || *rollingUpdate.Partition != partition {
+		return false, "", nil
+	}
+
+	replicas := int32(1)
+	if current.Spec.Replicas != nil {
+		replicas = *current.Spec.Replicas
+	}
+	if current.Status.ObservedGeneration < current.Generation ||
+		current.Status.UpdatedReplicas < replicas-partition ||
+		current.Status.ReadyReplicas < replicas {
+		return false, "", nil
+	}
+
+	if node.Canary.HealthGate == nil {
+		return true, "", nil
+	}
+
+	healthy, err := runHealthGate(s.Context.Context, &HealthGatePolicy{}, node.Canary.HealthGate, HealthGateTarget{
+		Workload: current,
+		Services: s.Service,
+		Client:   node.Client,
+	})
+	if err != nil {
+		return false, fmt.Sprintf("health gate has not passed, %s", err.Error()), nil
+	}
+	if !healthy {
+		return false, "health gate has not passed", nil
+	}
+	return true, "", nil
+}
+
+// podStartFailureReasons are the waiting reasons of a container which does not start without a
+// change of the pod template.
+var podStartFailureReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// statefulSetRolloutFailure returns an error when a pod of the update revision of the statefulset
+// fails to start, statefulsets do not report failed rollouts in their status.
+func statefulSetRolloutFailure(ctx context.Context, c client.Client, sts *appsv1.StatefulSet) error {
+
+	if sts.Status.UpdateRevision == "" {
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		return err
+	}
+
+	pods := &v1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(sts.GetNamespace()), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.GetLabels()[appsv1.ControllerRevisionHashLabelKey] != sts.Status.UpdateRevision {
+			continue
+		}
+		statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if status.State.Waiting != nil && podStartFailureReasons[status.State.Waiting.Reason] {
+				return fmt.Errorf("container [%s] of pod [%s] fails to start, %s %s", status.Name, pod.GetName(), status.State.Waiting.Reason, status.State.Waiting.Message)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isTemplateLive reports whether the live statefulset already runs the desired pod template, fields
+// defaulted by the api server are ignored.
+func isTemplateLive(desired, current *appsv1.StatefulSet) (bool, error) {
+
+	desiredTemplate, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&desired.Spec.Template)
+	if err != nil {
+		return false, err
+	}
+	currentTemplate, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&current.Spec.Template)
+	if err != nil {
+		return false, err
+	}
+	return isSubset(desiredTemplate, currentTemplate), nil
+}
+
+func validatePartitions(partitions []int32) error {
+	for i, partition := range partitions {
+		if partition < 0 || (i > 0 && partition >= partitions[i-1]) {
+			return fmt.Errorf("canary partitions %v must be non-negative and decreasing", partitions)
+		}
+	}
+	return nil
+}
+
+func canaryStateOf(sts *appsv1.StatefulSet) canaryState {
+
+	annotations := sts.GetAnnotations()
+	state := canaryState{
+		Revision: annotations[canaryRevisionAnnotation],
+		Paused:   annotations[CanaryPausedAnnotation],
+	}
+	state.Step, _ = strconv.Atoi(annotations[canaryStepAnnotation])
+	state.HealthySince, _ = time.Parse(time.RFC3339, annotations[canaryHealthySinceAnnotation])
+	state.StepStarted, _ = time.Parse(time.RFC3339, annotations[canaryStepStartedAnnotation])
+
+	return state
+}
+
+func partitionOf(sts *appsv1.StatefulSet) int32 {
+	if rollingUpdate := sts.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil {
+		return *rollingUpdate.Partition
+	}
+	return 0
+}
+
+// setCanaryState records the canary state on a statefulset along with its partition.
+func setCanaryState(sts *appsv1.StatefulSet, state canaryState, partition int32) {
+
+	annotations := make(map[string]string, len(sts.GetAnnotations())+5)
+	for key, value := range sts.GetAnnotations() {
+		annotations[key] = value
+	}
+	annotations[canaryRevisionAnnotation] = state.Revision
+	annotations[canaryStepAnnotation] = strconv.Itoa(state.Step)
+	delete(annotations, canaryHealthySinceAnnotation)
+	if !state.HealthySince.IsZero() {
+		annotations[canaryHealthySinceAnnotation] = state.HealthySince.Format(time.RFC3339)
+	}
+	delete(annotations, canaryStepStartedAnnotation)
+	if !state.StepStarted.IsZero() {
+		annotations[canaryStepStartedAnnotation] = state.StepStarted.Format(time.RFC3339)
+	}
+	delete(annotations, CanaryPausedAnnotation)
+	if state.Paused != "" {
+		annotations[CanaryPausedAnnotation] = state.Paused
+	}
+	sts.SetAnnotations(annotations)
+
+	sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+		Type: appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+			Partition: &partition,
+		},
+	}
+}
+
+// persistCanaryState patches the canary state and partition onto the live statefulset when they
+// changed.
+func persistCanaryState(ctx context.Context, c client.Client, current *appsv1.StatefulSet, state canaryState, partition int32) error {
+
+	patched := current.DeepCopy()
+	setCanaryState(patched, state, partition)
+	if equality.Semantic.DeepEqual(patched, current) {
+		return nil
+	}
+	return c.Patch(ctx, patched, client.MergeFrom(current))
+}
+
+// keepCanaryState carries the canary state of the live statefulset over to the desired one right
+// before it is written, so a write does not reset the partition of the rollout.
+func keepCanaryState(desired, current client.Object) {
+	desiredSts, ok := desired.(*appsv1.StatefulSet)
+	if !ok {
+		return
+	}
+	currentSts, ok := current.(*appsv1.StatefulSet)
+	if !ok {
+		return
+	}
+	setCanaryState(desiredSts, canaryStateOf(currentSts), partitionOf(currentSts))
+}
@@ -0,0 +1,290 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestCanaryNode(c client.Client, cr client.Object, gate HealthGate) BuilderDeploymentStatefulSet {
+	node := newTestNode(c, cr, "data", "Statefulset")
+	node.Replicas = 3
+	node.Canary = &CanaryStrategy{
+		Partitions:        []int32{2},
+		SoakTime:          time.Minute,
+		HealthGate:        gate,
+		HealthGateTimeout: time.Minute,
+	}
+	return node
+}
+
+func TestApplyCanary(t *testing.T) {
+
+	cr := newTestCr()
+
+	healthy := HealthGateFunc(func(ctx context.Context, target HealthGateTarget) (bool, error) { return true, nil })
+	unreachable := HealthGateFunc(func(ctx context.Context, target HealthGateTarget) (bool, error) {
+		return false, errors.New("connection refused")
+	})
+
+	template := newTestCanaryNode(nil, cr, nil)
+	desired, err := template.MakeStatefulSet()
+	if err != nil {
+		t.Fatalf("MakeStatefulSet() error = %v", err)
+	}
+	revision, err := specHash(desired.Spec.Template)
+	if err != nil {
+		t.Fatalf("specHash() error = %v", err)
+	}
+
+	ago := func(d time.Duration) string { return time.Now().UTC().Add(-d).Format(time.RFC3339) }
+	ready := appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 1, ReadyReplicas: 3, UpdateRevision: "data-2"}
+
+	crashing := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "data-2",
+			Namespace: testNamespace,
+			Labels:    map[string]string{"app": "test", appsv1.ControllerRevisionHashLabelKey: "data-2"},
+		},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+			Name:  "app",
+			State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		}}},
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		status      appsv1.StatefulSetStatus
+		gate        HealthGate
+		template    bool
+		existing    []client.Object
+		progressing bool
+		step        string
+		partition   int32
+		soaking     bool
+		paused      bool
+	}{
+		{
+			name:        "new revision starts at the first step",
+			progressing: true,
+			step:        "0",
+			partition:   2,
+		},
+		{
+			name:      "adopted statefulset running the template is complete",
+			template:  true,
+			step:      "1",
+			partition: 0,
+		},
+		{
+			name:        "step waits for its pods",
+			annotations: map[string]string{canaryRevisionAnnotation: revision, canaryStepAnnotation: "0", canaryStepStartedAnnotation: ago(time.Second)},
+			status:      appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 1, ReadyReplicas: 2},
+			progressing: true,
+			step:        "0",
+			partition:   2,
+		},
+		{
+			name:        "healthy step starts soaking",
+			annotations: map[string]string{canaryRevisionAnnotation: revision, canaryStepAnnotation: "0", canaryStepStartedAnnotation: ago(time.Second)},
+			status:      ready,
+			gate:        healthy,
+			progressing: true,
+			step:        "0",
+			partition:   2,
+			soaking:     true,
+		},
+		{
+			name:        "soaked step advances",
+			annotations: map[string]string{canaryRevisionAnnotation: revision, canaryStepAnnotation: "0", canaryHealthySinceAnnotation: ago(time.Hour)},
+			status:      ready,
+			gate:        healthy,
+			step:        "1",
+			partition:   0,
+		},
+		{
+			name:        "failing health gate keeps the step waiting",
+			annotations: map[string]string{canaryRevisionAnnotation: revision, canaryStepAnnotation: "0", canaryStepStartedAnnotation: ago(time.Second)},
+			status:      ready,
+			gate:        unreachable,
+			progressing: true,
+			step:        "0",
+			partition:   2,
+		},
+		{
+			name:        "health gate timeout pauses",
+			annotations: map[string]string{canaryRevisionAnnotation: revision, canaryStepAnnotation: "0", canaryStepStartedAnnotation: ago(time.Hour)},
+			status:      ready,
+			gate:        unreachable,
+			step:        "0",
+			partition:   2,
+			paused:      true,
+		},
+		{
+			name:        "pod start failure pauses",
+			annotations: map[string]string{canaryRevisionAnnotation: revision, canaryStepAnnotation: "0", canaryStepStartedAnnotation: ago(time.Second)},
+			status:      ready,
+			gate:        healthy,
+			existing:    []client.Object{crashing},
+			step:        "0",
+			partition:   2,
+			paused:      true,
+		},
+		{
+			name:        "paused rollout stays paused",
+			annotations: map[string]string{canaryRevisionAnnotation: revision, canaryStepAnnotation: "0", CanaryPausedAnnotation: "step [0] did not become healthy"},
+			status:      ready,
+			gate:        healthy,
+			step:        "0",
+			partition:   2,
+			paused:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			partition := int32(2)
+			live := newTestStatefulSet(cr, "data")
+			live.Generation = 1
+			live.Annotations = tt.annotations
+			live.Spec.Replicas = desired.Spec.Replicas
+			live.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition}
+			live.Status = tt.status
+			if tt.template {
+				live.Spec.Template = *desired.Spec.Template.DeepCopy()
+			}
+
+			c := newTestClient(append([]client.Object{cr.DeepCopy(), live}, tt.existing...)...)
+			node := newTestCanaryNode(c, cr, tt.gate)
+			b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder())
+
+			sts, err := node.MakeStatefulSet()
+			if err != nil {
+				t.Fatalf("MakeStatefulSet() error = %v", err)
+			}
+
+			progressing, err := b.applyCanary(node, sts)
+			if err != nil {
+				t.Fatalf("applyCanary() error = %v", err)
+			}
+			if progressing != tt.progressing {
+				t.Errorf("progressing = %v, want %v", progressing, tt.progressing)
+			}
+
+			// the state is patched onto the live statefulset, the desired one does not carry it
+			if sts.Spec.UpdateStrategy.RollingUpdate != nil {
+				t.Errorf("desired statefulset carries the partition")
+			}
+			if err := c.Get(context.Background(), objectKey("data"), live); err != nil {
+				t.Fatal(err)
+			}
+
+			annotations := live.GetAnnotations()
+			if step := annotations[canaryStepAnnotation]; step != tt.step {
+				t.Errorf("step = %s, want %s", step, tt.step)
+			}
+			if got := partitionOf(live); got != tt.partition {
+				t.Errorf("partition = %d, want %d", got, tt.partition)
+			}
+			if _, soaking := annotations[canaryHealthySinceAnnotation]; soaking != tt.soaking {
+				t.Errorf("soaking = %v, want %v", soaking, tt.soaking)
+			}
+			if _, paused := annotations[CanaryPausedAnnotation]; paused != tt.paused {
+				t.Errorf("paused = %v, want %v (%s)", paused, tt.paused, annotations[CanaryPausedAnnotation])
+			}
+		})
+	}
+}
+
+func TestReconcileStoreKeepsNodeTypesWhileCanarySoaks(t *testing.T) {
+
+	cr := newTestCr()
+	c := newTestClient(cr.DeepCopy(), newTestDeployment(cr, "query"))
+
+	// the statefulset is created, then its template changes and the first step waits, every
+	// reconcile starts from a new builder
+	var b *Builder
+	var result Result
+	for _, image := range []string{"app:1", "app:2", "app:2"} {
+		node := newTestCanaryNode(c, cr, nil)
+		node.PodSpec = &v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: image}}}
+
+		b = newTestBuilder(c, cr.DeepCopy(), newTestRecorder(), ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{
+			node,
+			newTestNode(c, cr, "query", "Deployment"),
+		}))
+
+		var err error
+		if result, err = b.ReconcileDeployOrSts(); err != nil {
+			t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+		}
+	}
+
+	if !result.RolloutInProgress {
+		t.Fatalf("RolloutInProgress = false, want true")
+	}
+	if err := b.ReconcileStore(); err != nil {
+		t.Fatalf("ReconcileStore() error = %v", err)
+	}
+
+	if !exists(c, newTestDeployment(cr, "query")) {
+		t.Errorf("node type after a waiting canary was collected")
+	}
+}
+
+func TestCanaryStateIsNotHashed(t *testing.T) {
+
+	cr := newTestCr()
+	c := newTestClient(cr.DeepCopy())
+	recorder := newTestRecorder()
+
+	reconcile := func(image string) *appsv1.StatefulSet {
+		t.Helper()
+		node := newTestCanaryNode(c, cr, nil)
+		node.PodSpec = &v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: image}}}
+		b := newTestBuilder(c, cr.DeepCopy(), recorder, ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{node}))
+		if _, err := b.ReconcileDeployOrSts(); err != nil {
+			t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+		}
+		live := &appsv1.StatefulSet{}
+		if err := c.Get(context.Background(), objectKey("data"), live); err != nil {
+			t.Fatal(err)
+		}
+		return live
+	}
+
+	// the statefulset predates the canary state, it is adopted without a rollout
+	created := reconcile("app:1")
+	adopted := reconcile("app:1")
+	if step := adopted.Annotations[canaryStepAnnotation]; step != "1" {
+		t.Errorf("step = %s after adoption, want 1", step)
+	}
+	if hasEvent(recorder, "Canary") {
+		t.Errorf("adoption of an unchanged template started a rollout")
+	}
+	if hash := created.Annotations["ConfigMapOperatorHash"]; hash == "" || adopted.Annotations["ConfigMapOperatorHash"] != hash {
+		t.Errorf("canary state changed the hash of the statefulset")
+	}
+
+	rolling := reconcile("app:2")
+	if got := partitionOf(rolling); got != 2 {
+		t.Fatalf("partition = %d after a template change, want 2", got)
+	}
+
+	// the step waits for its pods, further reconciles keep the partition and the hash
+	waiting := reconcile("app:2")
+	if got := partitionOf(waiting); got != 2 {
+		t.Errorf("partition = %d while the step waits, want 2", got)
+	}
+	if waiting.ResourceVersion != rolling.ResourceVersion {
+		t.Errorf("statefulset was written while the step waits")
+	}
+}
@@ -2,7 +2,9 @@ package builder
 
 import (
 	"context"
+	"fmt"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -29,8 +31,89 @@ func (b *CommonBuilder) Update(ctx context.Context, buildRecorder BuilderRecorde
 	}
 }
 
+// Apply sends the desired state as a server-side apply patch, only the fields set on the
+// desired object are owned by the field manager so fields set by other controllers are kept.
+func (b *CommonBuilder) Apply(ctx context.Context, buildRecorder BuilderRecorder) (controllerutil.OperationResult, error) {
+	result := controllerutil.OperationResultUpdated
+
+	if err := b.Client.Get(ctx, *namespacedName(b.DesiredState.GetName(), b.DesiredState.GetNamespace()), b.CurrentState); err != nil {
+		if !apierrors.IsNotFound(err) {
+			buildRecorder.getEvent(b.CrObject, b.DesiredState, err)
+			return controllerutil.OperationResultNone, err
+		}
+		result = controllerutil.OperationResultCreated
+	} else {
+		if b.CurrentState.GetDeletionTimestamp() != nil {
+			return controllerutil.OperationResultNone, nil
+		}
+		drifted, err := b.isDriftedFromDesired(buildRecorder)
+		if err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		if !drifted && b.DesiredState.GetAnnotations()[b.OwnerRef.Kind+"OperatorHash"] == b.CurrentState.GetAnnotations()[b.OwnerRef.Kind+"OperatorHash"] {
+			return controllerutil.OperationResultNone, nil
+		}
+	}
+
+	if b.beforeWrite != nil {
+		if result == controllerutil.OperationResultCreated {
+			b.beforeWrite(b.DesiredState, nil)
+		} else {
+			b.beforeWrite(b.DesiredState, b.CurrentState)
+		}
+	}
+
+	// the replicas of an existing autoscaled workload are owned by the autoscaler
+	if b.autoscaled && result == controllerutil.OperationResultUpdated {
+		if err := b.handOverReplicas(ctx, b.fieldManager(buildRecorder)); err != nil {
+			buildRecorder.updateEvent(b.CrObject, b.DesiredState, err)
+			return controllerutil.OperationResultNone, err
+		}
+		clearReplicas(b.DesiredState)
+	}
+
+	// apply patches must not carry a resource version or managed fields
+	b.DesiredState.SetResourceVersion("")
+	b.DesiredState.SetManagedFields(nil)
+
+	if err := b.Client.Patch(ctx, b.DesiredState, client.Apply, b.applyOptions(buildRecorder)...); err != nil {
+		if result == controllerutil.OperationResultCreated {
+			buildRecorder.createEvent(b.CrObject, b.DesiredState, err)
+			return controllerutil.OperationResultNone, err
+		}
+		buildRecorder.updateEvent(b.CrObject, b.DesiredState, err)
+		return b.handleUpdateError(ctx, buildRecorder, err)
+	}
+
+	if result == controllerutil.OperationResultCreated {
+		buildRecorder.createEvent(b.CrObject, b.DesiredState, nil)
+	} else {
+		buildRecorder.updateEvent(b.CrObject, b.DesiredState, nil)
+	}
+	return result, nil
+}
+
+func (b *CommonBuilder) fieldManager(buildRecorder BuilderRecorder) string {
+	fieldManager := b.ServerSideApply.FieldManager
+	if fieldManager == "" {
+		fieldManager = buildRecorder.ControllerName
+	}
+	if fieldManager == "" {
+		fieldManager = "operator-runtime"
+	}
+	return fieldManager
+}
+
+func (b *CommonBuilder) applyOptions(buildRecorder BuilderRecorder) []client.PatchOption {
+	opts := []client.PatchOption{client.FieldOwner(b.fieldManager(buildRecorder))}
+	if b.ServerSideApply.ForceOwnership {
+		opts = append(opts, client.ForceOwnership)
+	}
+	return opts
+}
+
 func (b *CommonBuilder) Get(ctx context.Context, buildRecorder BuilderRecorder) (client.Object, error) {
-        if err := b.Client.Get(ctx, *namespacedName(b.ObjectMeta.GetName(), b.ObjectMeta.Namespace), b.CurrentState); err != nil {
+	if err := b.Client.Get(ctx, *namespacedName(b.ObjectMeta.GetName(), b.ObjectMeta.Namespace), b.CurrentState); err != nil {
 		return nil, err
 	} else {
 		return b.CurrentState, nil
@@ -52,7 +135,12 @@ func (b *CommonBuilder) List(ctx context.Context, buildRecorder BuilderRecorder)
 }
 
 func (b *CommonBuilder) Delete(ctx context.Context, buildRecorder BuilderRecorder) (controllerutil.OperationResult, error) {
-	if err := b.Client.Delete(ctx, b.DesiredState); err != nil {
+	var opts []client.DeleteOption
+	if b.DeletePropagation != nil {
+		opts = append(opts, client.PropagationPolicy(*b.DeletePropagation))
+	}
+
+	if err := b.Client.Delete(ctx, b.DesiredState, opts...); err != nil {
 		buildRecorder.deleteEvent(b.CrObject, b.DesiredState, err)
 		return controllerutil.OperationResultNone, err
 	} else {
@@ -64,3 +152,51 @@ func (b *CommonBuilder) Delete(ctx context.Context, buildRecorder BuilderRecorde
 func namespacedName(name, namespace string) *types.NamespacedName {
 	return &types.NamespacedName{Name: name, Namespace: namespace}
 }
+
+// annotateCr sets an annotation on the custom resource with a merge patch, the runtime records
+// progress there which must survive operator restarts.
+func (b *CommonBuilder) annotateCr(ctx context.Context, key, value string) error {
+
+	base, ok := b.CrObject.DeepCopyObject().(client.Object)
+	if !ok {
+		return fmt.Errorf("custom resource [%s] cannot be copied", b.CrObject.GetName())
+	}
+
+	annotations := make(map[string]string, len(b.CrObject.GetAnnotations())+1)
+	for key, value := range b.CrObject.GetAnnotations() {
+		annotations[key] = value
+	}
+	annotations[key] = value
+	b.CrObject.SetAnnotations(annotations)
+
+	return b.Client.Patch(ctx, b.CrObject, client.MergeFrom(base))
+}
+
+// removeCrAnnotations removes annotations from the custom resource with a merge patch, it does
+// nothing when none of them is set.
+func (b *CommonBuilder) removeCrAnnotations(ctx context.Context, keys ...string) error {
+
+	base, ok := b.CrObject.DeepCopyObject().(client.Object)
+	if !ok {
+		return fmt.Errorf("custom resource [%s] cannot be copied", b.CrObject.GetName())
+	}
+
+	annotations := make(map[string]string, len(b.CrObject.GetAnnotations()))
+	for key, value := range b.CrObject.GetAnnotations() {
+		annotations[key] = value
+	}
+
+	var removed bool
+	for _, key := range keys {
+		if _, ok := annotations[key]; ok {
+			delete(annotations, key)
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+	b.CrObject.SetAnnotations(annotations)
+
+	return b.Client.Patch(ctx, b.CrObject, client.MergeFrom(base))
+}
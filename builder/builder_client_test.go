@@ -0,0 +1,117 @@
+package builder
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// applyRecordingClient records apply patches instead of sending them, the fake client does not
+// implement server-side apply.
+type applyRecordingClient struct {
+	client.Client
+	applied []client.Object
+	options []*client.PatchOptions
+}
+
+func (c *applyRecordingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	c.applied = append(c.applied, obj.DeepCopyObject().(client.Object))
+	c.options = append(c.options, (&client.PatchOptions{}).ApplyOptions(opts))
+	return nil
+}
+
+func TestCreateOrUpdateServerSideApply(t *testing.T) {
+
+	cr := newTestCr()
+
+	tests := []struct {
+		name      string
+		existing  map[string]string
+		apply     ServerSideApply
+		operation controllerutil.OperationResult
+		manager   string
+		force     bool
+	}{
+		{
+			name:      "absent object is applied",
+			operation: controllerutil.OperationResultCreated,
+			manager:   "Test",
+		},
+		{
+			name:      "field manager and force are sent",
+			apply:     ServerSideApply{FieldManager: "druid-operator", ForceOwnership: true},
+			operation: controllerutil.OperationResultCreated,
+			manager:   "druid-operator",
+			force:     true,
+		},
+		{
+			name:      "changed object is applied",
+			existing:  map[string]string{"key": "old"},
+			operation: controllerutil.OperationResultUpdated,
+			manager:   "Test",
+		},
+		{
+			name:      "unchanged object is not applied",
+			existing:  map[string]string{"key": "value"},
+			operation: controllerutil.OperationResultNone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c := &applyRecordingClient{Client: newTestClient()}
+			recorder := newTestRecorder()
+
+			// the live object is written by a plain update, so it carries the hash of its data
+			if tt.existing != nil {
+				existing := newTestCommonBuilder(c, cr, "config")
+				existing.DesiredState = newTestConfigMap("config", tt.existing)
+				existing.CurrentState = &v1.ConfigMap{}
+				if _, err := existing.CreateOrUpdate(context.Background(), recorder); err != nil {
+					t.Fatalf("CreateOrUpdate() error = %v", err)
+				}
+			}
+
+			apply := tt.apply
+			b := newTestCommonBuilder(c, cr, "config")
+			b.ServerSideApply = &apply
+			b.DesiredState = newTestConfigMap("config", map[string]string{"key": "value"})
+			b.CurrentState = &v1.ConfigMap{}
+
+			operation, err := b.CreateOrUpdate(context.Background(), recorder)
+			if err != nil {
+				t.Fatalf("CreateOrUpdate() error = %v", err)
+			}
+			if operation != tt.operation {
+				t.Errorf("CreateOrUpdate() = %s, want %s", operation, tt.operation)
+			}
+
+			if tt.operation == controllerutil.OperationResultNone {
+				if len(c.applied) != 0 {
+					t.Errorf("%d patches applied, want none", len(c.applied))
+				}
+				return
+			}
+			if len(c.applied) != 1 {
+				t.Fatalf("%d patches applied, want 1", len(c.applied))
+			}
+			if rv := c.applied[0].GetResourceVersion(); rv != "" {
+				t.Errorf("applied resource version = %q, want none", rv)
+			}
+			if manager := c.options[0].FieldManager; manager != tt.manager {
+				t.Errorf("field manager = %q, want %q", manager, tt.manager)
+			}
+			if force := c.options[0].Force != nil && *c.options[0].Force; force != tt.force {
+				t.Errorf("force = %v, want %v", force, tt.force)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"github.com/datainfrahq/operator-runtime/utils"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podTemplateConfigHashAnnotation holds the combined hash of the data of the configmaps and secrets
+// referenced by the pod template, a change of the data rolls out the workload.
+const podTemplateConfigHashAnnotation = "operator-runtime.datainfra.io/config-hash"
+
+// ConfigReference names a configmap or secret referenced by a pod spec.
+type ConfigReference struct {
+	// Kind is ConfigMap or Secret.
+	Kind string
+	Name string
+}
+
+// stampConfigHash hashes the data of the configmaps and secrets referenced by the pod template into
+// its annotations. References which do not exist yet are left out, their creation rolls the pods.
+func (s *Builder) stampConfigHash(node BuilderDeploymentStatefulSet, template *v1.PodTemplateSpec) error {
+
+	ignored := make(map[ConfigReference]bool, len(node.IgnoredConfigReferences))
+	for _, ref := range node.IgnoredConfigReferences {
+		ignored[ref] = true
+	}
+
+	configMaps, secrets := referencedConfig(&template.Spec)
+
+	var objects []utils.ConfigMapHash
+	for _, name := range configMaps {
+		if ignored[ConfigReference{Kind: string(configMap), Name: name}] {
+			continue
+		}
+
+		current := &v1.ConfigMap{}
+		if err := node.Client.Get(s.Context.Context, *namespacedName(name, node.ObjectMeta.Namespace), current); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		// only the data is hashed, metadata changes do not restart the pods
+		objects = append(objects, utils.ConfigMapHash{Object: &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: string(configMap) + "/" + name},
+			Data:       current.Data,
+			BinaryData: current.BinaryData,
+		}})
+	}
+
+	for _, name := range secrets {
+		if ignored[ConfigReference{Kind: string(secret), Name: name}] {
+			continue
+		}
+
+		current := &v1.Secret{}
+		if err := node.Client.Get(s.Context.Context, *namespacedName(name, node.ObjectMeta.Namespace), current); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		objects = append(objects, utils.ConfigMapHash{Object: &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: string(secret) + "/" + name},
+			Data:       current.Data,
+		}})
+	}
+
+	if len(objects) == 0 {
+		return nil
+	}
+
+	hashes, err := utils.MakeConfigMapHash(objects)
+	if err != nil {
+		return err
+	}
+
+	combined := sha256.New()
+	for _, hash := range hashes {
+		combined.Write([]byte(hash.Name + "=" + hash.HashVaule + "\n"))
+	}
+
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[podTemplateConfigHashAnnotation] = hex.EncodeToString(combined.Sum(nil))
+	return nil
+}
+
+// referencedConfig returns the sorted names of the configmaps and secrets mounted or read into
+// environment variables by the pod.
+func referencedConfig(spec *v1.PodSpec) ([]string, []string) {
+
+	configMaps := make(map[string]bool)
+	secrets := make(map[string]bool)
+
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil {
+			configMaps[volume.ConfigMap.Name] = true
+		}
+		if volume.Secret != nil {
+			secrets[volume.Secret.SecretName] = true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					configMaps[source.ConfigMap.Name] = true
+				}
+				if source.Secret != nil {
+					secrets[source.Secret.Name] = true
+				}
+			}
+		}
+	}
+
+	containers := append(append([]v1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				configMaps[envFrom.ConfigMapRef.Name] = true
+			}
+			if envFrom.SecretRef != nil {
+				secrets[envFrom.SecretRef.Name] = true
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				configMaps[env.ValueFrom.ConfigMapKeyRef.Name] = true
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				secrets[env.ValueFrom.SecretKeyRef.Name] = true
+			}
+		}
+	}
+
+	return sortedKeys(configMaps), sortedKeys(secrets)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
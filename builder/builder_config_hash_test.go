@@ -0,0 +1,77 @@
+package builder
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestStampConfigHash(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		ignored []ConfigReference
+		update  func(cm *v1.ConfigMap)
+		rolled  bool
+	}{
+		{
+			name:   "data change rolls the workload",
+			update: func(cm *v1.ConfigMap) { cm.Data["level"] = "debug" },
+			rolled: true,
+		},
+		{
+			name:   "metadata change keeps the workload",
+			update: func(cm *v1.ConfigMap) { cm.Labels = map[string]string{"team": "data"} },
+		},
+		{
+			name:    "ignored reference keeps the workload",
+			ignored: []ConfigReference{{Kind: "ConfigMap", Name: "logging"}},
+			update:  func(cm *v1.ConfigMap) { cm.Data["level"] = "debug" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := newTestCr()
+			c := newTestClient(newTestConfigMap("logging", map[string]string{"level": "info"}))
+
+			reconcile := func() string {
+				t.Helper()
+				node := newTestNode(c, cr, "broker", "Deployment")
+				node.IgnoredConfigReferences = tt.ignored
+				node.PodSpec.Volumes = []v1.Volume{{
+					Name: "logging",
+					VolumeSource: v1.VolumeSource{
+						ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "logging"}},
+					},
+				}}
+				b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{node}))
+				if _, err := b.ReconcileDeployOrSts(); err != nil {
+					t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+				}
+				live := &appsv1.Deployment{}
+				if err := c.Get(context.Background(), objectKey("broker"), live); err != nil {
+					t.Fatal(err)
+				}
+				return live.Spec.Template.Annotations[podTemplateConfigHashAnnotation]
+			}
+
+			hash := reconcile()
+
+			cm := &v1.ConfigMap{}
+			if err := c.Get(context.Background(), objectKey("logging"), cm); err != nil {
+				t.Fatal(err)
+			}
+			tt.update(cm)
+			if err := c.Update(context.Background(), cm); err != nil {
+				t.Fatal(err)
+			}
+
+			if rolled := reconcile() != hash; rolled != tt.rolled {
+				t.Errorf("config hash changed = %v, want %v", rolled, tt.rolled)
+			}
+		})
+	}
+}
@@ -17,15 +17,18 @@ func ToNewBuilderConfigMap(builder []BuilderConfigMap) func(*Builder) {
 	}
 }
 
-func (s *Builder) ReconcileConfigMap() (controllerutil.OperationResult, error) {
+func (s *Builder) ReconcileConfigMap() (Result, error) {
 
-	var result controllerutil.OperationResult
+	var result Result
+
+	s.manageKind(string(configMap))
 
 	for _, configMap := range s.ConfigMaps {
 
 		cm, err := configMap.makeConfigMap()
 		if err != nil {
-			return controllerutil.OperationResultNone, err
+			result.add("ConfigMap", configMap.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			continue
 		}
 
 		s.Put(cm.GetName(), cm.Kind)
@@ -33,13 +36,11 @@ func (s *Builder) ReconcileConfigMap() (controllerutil.OperationResult, error) {
 		configMap.DesiredState = cm
 		configMap.CurrentState = &v1.ConfigMap{}
 
-		result, err = configMap.CreateOrUpdate(s.Context.Context, s.Recorder)
-		if err != nil {
-			return result, nil
-		}
+		operation, err := configMap.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(cm.Kind, cm.GetName(), operation, err)
 	}
 
-	return result, nil
+	return result, result.Err()
 }
 
 func (b *BuilderConfigMap) makeConfigMap() (*v1.ConfigMap, error) {
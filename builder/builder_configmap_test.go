@@ -0,0 +1,55 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// failingCreateClient fails the creation of objects named in failures.
+type failingCreateClient struct {
+	client.Client
+	failures map[string]error
+}
+
+func (c *failingCreateClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err, ok := c.failures[obj.GetName()]; ok {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestReconcileConfigMapContinuesAfterFailures(t *testing.T) {
+
+	cr := newTestCr()
+	quota := errors.New("exceeded quota")
+	c := &failingCreateClient{Client: newTestClient(), failures: map[string]error{"first": quota}}
+
+	var configMaps []BuilderConfigMap
+	for _, name := range []string{"first", "second"} {
+		configMaps = append(configMaps, BuilderConfigMap{
+			Data:          map[string]string{"key": name},
+			CommonBuilder: newTestCommonBuilder(c, cr, name),
+		})
+	}
+
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderConfigMap(configMaps))
+
+	result, err := b.ReconcileConfigMap()
+	if !errors.Is(err, quota) {
+		t.Fatalf("ReconcileConfigMap() error = %v, want %v", err, quota)
+	}
+
+	var objectErr *ObjectError
+	if !errors.As(err, &objectErr) || objectErr.Kind != "ConfigMap" || objectErr.Name != "first" {
+		t.Errorf("ReconcileConfigMap() error = %v, want an ObjectError of config map [first]", err)
+	}
+	if len(result.Objects) != 2 {
+		t.Errorf("%d objects reconciled, want 2", len(result.Objects))
+	}
+	if !exists(c, newTestConfigMap("second", nil)) {
+		t.Error("config map [second] was not created after [first] failed")
+	}
+}
@@ -2,11 +2,12 @@ package builder
 
 import (
 	"context"
-	"errors"
+	"fmt"
 
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
@@ -16,7 +17,39 @@ type BuilderDeploymentStatefulSet struct {
 	VolumeClaimTemplate []BuilderStorageConfig
 	ServiceName         string
 	PodSpec             *v1.PodSpec
-	Kind                string
+	// Kind is Deployment, Statefulset or DaemonSet, Replicas is ignored for a DaemonSet.
+	Kind string
+	// PvcRetentionPolicySupported enables the statefulset persistentVolumeClaimRetentionPolicy,
+	// see utils.IsPvcRetentionPolicySupported.
+	PvcRetentionPolicySupported bool
+	// DependsOn names the node types which must be fully deployed before this node type
+	// is rolled out, see reconcileRolloutGraph.
+	DependsOn []string
+	// PodDisruptionBudget generates a pdb for the node type, see ReconcilePodDisruptionBudget.
+	PodDisruptionBudget *PodDisruptionBudgetPolicy
+	// ReplicasManagedExternally leaves spec.replicas to an autoscaler managed outside the runtime,
+	// Replicas is then only used on creation. Node types targeted by a BuilderHPA behave the same.
+	ReplicasManagedExternally bool
+	// Identity generates a ServiceAccount named after the node type and runs its pods as it,
+	// see ReconcileServiceAccount.
+	Identity *NodeIdentity
+	// WaitForJobs names the BuilderJobs which must have succeeded with their current spec before
+	// the node type is rolled out.
+	WaitForJobs []string
+	// IgnoredConfigReferences lists the configmaps and secrets referenced by the pod spec whose
+	// changes do not restart the pods, see stampConfigHash.
+	IgnoredConfigReferences []ConfigReference
+	// Canary rolls pod template changes of a statefulset out step by step, see applyCanary.
+	Canary *CanaryStrategy
+	// RollbackOnFailure restores the last known-good pod template of a deployment whose rollout
+	// failed, see checkRollout.
+	RollbackOnFailure bool
+	// HealthGates hold back the node types after this one until the application reports healthy,
+	// see checkHealthGates.
+	HealthGates *HealthGatePolicy
+	// ScaleDown decommissions the pods of a statefulset before lowering its replicas, see
+	// applyScaleDown.
+	ScaleDown *ScaleDownPolicy
 	CommonBuilder
 }
 
@@ -26,46 +59,152 @@ func ToNewBuilderDeploymentStatefulSet(builder []BuilderDeploymentStatefulSet) f
 	}
 }
 
-func (s *Builder) ReconcileDeployOrSts() (controllerutil.OperationResult, error) {
+func (s *Builder) ReconcileDeployOrSts() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(deployment))
+	s.manageKind(string(statefulSet))
+	s.manageKind(string(daemonSet))
+
+	s.putNodeTypes()
 
 	for _, deployorsts := range s.DeploymentOrStatefulset {
+		if len(deployorsts.VolumeClaimTemplate) > 0 {
+			s.manageKind(string(pvc))
+		}
+	}
+
+	if err := s.pruneHealthGateAnnotations(); err != nil {
+		result.add(detectType(s.Store.CrObject, s.Store.Client.Scheme()), s.Store.CrObject.GetName(), controllerutil.OperationResultNone, err)
+		return result, result.Err()
+	}
+
+	if hasRolloutDependencies(s.DeploymentOrStatefulset) {
+		order, err := rolloutOrder(s.DeploymentOrStatefulset)
+		if err != nil {
+			return result, err
+		}
+		return s.reconcileRolloutGraph(order)
+	}
+
+	for _, deployorsts := range s.DeploymentOrStatefulset {
+
+		succeeded, err := s.areJobsSucceeded(deployorsts)
+		if err != nil {
+			result.add(workloadKind(deployorsts), deployorsts.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			return result, result.Err()
+		}
+		if !succeeded {
+			result.rolloutInProgress()
+			return result, nil
+		}
 
 		if deployorsts.Kind == "Deployment" {
-			result, err := s.buildDeployment(deployorsts)
+			operation, err := s.buildDeployment(deployorsts)
+			result.add(string(deployment), deployorsts.ObjectMeta.Name, operation, err)
+			// node types after a failed one are not rolled out
 			if err != nil {
-				return controllerutil.OperationResultNone, err
+				return result, result.Err()
 			}
-			if result == controllerutil.OperationResultUpdated {
-				return controllerutil.OperationResultNone, nil
+			if operation == controllerutil.OperationResultUpdated {
+				result.rolloutInProgress()
+				return result, nil
 			}
 
-			if deployorsts.CrObject.GetGeneration() > 1 {
+			if deployorsts.CrObject.GetGeneration() > 1 || deployorsts.RollbackOnFailure || deployorsts.HealthGates != nil {
 				deployorsts.CurrentState = &appsv1.Deployment{}
-				done, _ := deployorsts.isObjFullyDeployed(s.Context.Context, s.Recorder)
+				done, halted, err := s.checkRollout(deployorsts)
+				if err != nil {
+					result.add(string(deployment), deployorsts.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+					return result, result.Err()
+				}
+				// node types after a rolled back one wait for the custom resource to change
+				if halted {
+					return result, nil
+				}
 				if !done {
+					result.rolloutInProgress()
 					break
 				}
 			}
 		} else if deployorsts.Kind == "Statefulset" {
 			deployorsts.CurrentState = &appsv1.StatefulSet{}
 
-			result, err := s.buildStatefulset(deployorsts)
+			operation, err := s.buildStatefulset(deployorsts)
+			result.add(string(statefulSet), deployorsts.ObjectMeta.Name, operation, err)
+			// node types after a failed one are not rolled out
 			if err != nil {
-				return controllerutil.OperationResultNone, err
+				return result, result.Err()
 			}
-			if result == controllerutil.OperationResultUpdated {
-				return controllerutil.OperationResultNone, nil
+			if operation == controllerutil.OperationResultUpdated {
+				result.rolloutInProgress()
+				return result, nil
 			}
 
-			if deployorsts.CrObject.GetGeneration() > 1 {
-				done, _ := deployorsts.isObjFullyDeployed(s.Context.Context, s.Recorder)
+			if deployorsts.CrObject.GetGeneration() > 1 || deployorsts.HealthGates != nil {
+				done, _, err := s.checkRollout(deployorsts)
+				if err != nil {
+					result.add(string(statefulSet), deployorsts.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+					return result, result.Err()
+				}
 				if !done {
+					result.rolloutInProgress()
 					break
 				}
 			}
+		} else if deployorsts.Kind == "DaemonSet" {
+			operation, err := s.buildDaemonSet(deployorsts)
+			result.add(string(daemonSet), deployorsts.ObjectMeta.Name, operation, err)
+			// node types after a failed one are not rolled out
+			if err != nil {
+				return result, result.Err()
+			}
+			if operation == controllerutil.OperationResultUpdated {
+				result.rolloutInProgress()
+				return result, nil
+			}
+
+			if deployorsts.CrObject.GetGeneration() > 1 || deployorsts.HealthGates != nil {
+				deployorsts.CurrentState = &appsv1.DaemonSet{}
+				done, _, err := s.checkRollout(deployorsts)
+				if err != nil {
+					result.add(string(daemonSet), deployorsts.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+					return result, result.Err()
+				}
+				if !done {
+					result.rolloutInProgress()
+					break
+				}
+			}
+		} else {
+			result.add(deployorsts.Kind, deployorsts.ObjectMeta.Name, controllerutil.OperationResultNone, unknownKindError(deployorsts))
+			return result, result.Err()
+		}
+	}
+	return result, nil
+}
+
+// putNodeTypes records every node type as desired before any of them is built, node types left
+// behind by a rollout which stops early or is halted must not be garbage collected. The rollout
+// history of a deployment is kept along with it.
+func (s *Builder) putNodeTypes() {
+	for _, node := range s.DeploymentOrStatefulset {
+		switch node.Kind {
+		case "Deployment", "Statefulset", "DaemonSet":
+			s.Put(node.ObjectMeta.Name, workloadKind(node))
+		}
+		if node.Kind == "Deployment" && node.RollbackOnFailure {
+			s.Put(node.ObjectMeta.Name+rolloutHistorySuffix, string(configMap))
 		}
 	}
-	return controllerutil.OperationResultNone, nil
+}
+
+func workloadKind(node BuilderDeploymentStatefulSet) string {
+	if node.Kind == "Statefulset" {
+		return string(statefulSet)
+	}
+	return node.Kind
 }
 
 func (b *CommonBuilder) isObjFullyDeployed(ctx context.Context, recorder BuilderRecorder) (bool, error) {
@@ -76,25 +215,38 @@ func (b *CommonBuilder) isObjFullyDeployed(ctx context.Context, recorder Builder
 		return false, err
 	}
 
-	if detectType(obj) == "*v1.StatefulSet" {
-		if obj.(*appsv1.StatefulSet).Status.CurrentRevision != obj.(*appsv1.StatefulSet).Status.UpdateRevision {
+	return isWorkloadReady(obj)
+}
+
+// isWorkloadReady reports whether the rollout of a deployment, statefulset or daemonset completed.
+func isWorkloadReady(obj client.Object) (bool, error) {
+
+	switch obj := obj.(type) {
+	case *appsv1.StatefulSet:
+		if obj.Status.CurrentRevision != obj.Status.UpdateRevision {
 			return false, nil
-		} else if obj.(*appsv1.StatefulSet).Status.CurrentReplicas != obj.(*appsv1.StatefulSet).Status.ReadyReplicas {
+		} else if obj.Status.CurrentReplicas != obj.Status.ReadyReplicas {
 			return false, nil
 		} else {
-			return obj.(*appsv1.StatefulSet).Status.CurrentRevision == obj.(*appsv1.StatefulSet).Status.UpdateRevision, nil
-		}
-	} else if detectType(obj) == "*v1.Deployment" {
-		for _, condition := range obj.(*appsv1.Deployment).Status.Conditions {
-			// This detects a failure condition, operator should send a rolling deployment failed event
-			if condition.Type == appsv1.DeploymentReplicaFailure {
-				return false, errors.New(condition.Reason)
-			} else if condition.Type == appsv1.DeploymentProgressing && condition.Status != v1.ConditionTrue || obj.(*appsv1.Deployment).Status.ReadyReplicas != obj.(*appsv1.Deployment).Status.Replicas {
-				return false, nil
-			} else {
-				return obj.(*appsv1.Deployment).Status.ReadyReplicas == obj.(*appsv1.Deployment).Status.Replicas, nil
+			return obj.Status.CurrentRevision == obj.Status.UpdateRevision, nil
+		}
+	case *appsv1.Deployment:
+		// This detects a failure condition, operator should send a rolling deployment failed event
+		if err := deploymentRolloutFailure(obj); err != nil {
+			return false, err
+		}
+		for _, condition := range obj.Status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing && condition.Status == v1.ConditionTrue {
+				return obj.Status.ReadyReplicas == obj.Status.Replicas, nil
 			}
 		}
+	case *appsv1.DaemonSet:
+		// the status does not reflect the latest spec yet
+		if obj.Status.ObservedGeneration < obj.Generation {
+			return false, nil
+		}
+		return obj.Status.UpdatedNumberScheduled == obj.Status.DesiredNumberScheduled &&
+			obj.Status.NumberAvailable == obj.Status.DesiredNumberScheduled, nil
 	}
 	return false, nil
 }
@@ -118,7 +270,7 @@ func (b *BuilderDeploymentStatefulSet) makeDeployment() (*appsv1.Deployment, err
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: b.Labels,
 				},
-				Spec: *b.PodSpec,
+				Spec: b.podSpec(),
 			},
 		},
 	}, nil
@@ -128,8 +280,8 @@ func (b *BuilderDeploymentStatefulSet) MakeStatefulSet() (*appsv1.StatefulSet, e
 
 	return &appsv1.StatefulSet{
 		TypeMeta: metav1.TypeMeta{
-			APIVersion: "v1",
-			Kind:       "Statefulset",
+			APIVersion: "apps/v1",
+			Kind:       "StatefulSet",
 		},
 		ObjectMeta: b.ObjectMeta,
 		Spec: appsv1.StatefulSetSpec{
@@ -139,15 +291,62 @@ func (b *BuilderDeploymentStatefulSet) MakeStatefulSet() (*appsv1.StatefulSet, e
 			},
 			ServiceName: b.ServiceName,
 			Template: v1.PodTemplateSpec{
-				Spec: *b.PodSpec,
+				Spec: b.podSpec(),
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: b.Labels,
+				},
+			},
+		},
+	}, nil
+}
+
+func (b *BuilderDeploymentStatefulSet) makeDaemonSet() (*appsv1.DaemonSet, error) {
+
+	return &appsv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apps/v1",
+			Kind:       "DaemonSet",
+		},
+		ObjectMeta: b.ObjectMeta,
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: b.Labels,
+			},
+			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: b.Labels,
 				},
+				Spec: b.podSpec(),
 			},
 		},
 	}, nil
 }
 
+// podSpec returns the pod spec of the node type bound to its generated ServiceAccount, if any.
+func (b *BuilderDeploymentStatefulSet) podSpec() v1.PodSpec {
+	podSpec := *b.PodSpec
+	if b.Identity != nil {
+		podSpec.ServiceAccountName = b.ObjectMeta.Name
+	}
+	return podSpec
+}
+
+// derivedCommonBuilder returns the builder settings of an object generated for the node type.
+func (b *BuilderDeploymentStatefulSet) derivedCommonBuilder(name, namespace string) CommonBuilder {
+	return CommonBuilder{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    b.ObjectMeta.Labels,
+		},
+		Client:          b.Client,
+		OwnerRef:        b.OwnerRef,
+		CrObject:        b.CrObject,
+		ServerSideApply: b.ServerSideApply,
+		DetectDrift:     b.DetectDrift,
+	}
+}
+
 func (s *Builder) buildDeployment(deploy BuilderDeploymentStatefulSet) (controllerutil.OperationResult, error) {
 
 	deployment, err := deploy.makeDeployment()
@@ -157,6 +356,22 @@ func (s *Builder) buildDeployment(deploy BuilderDeploymentStatefulSet) (controll
 
 	s.Put(deployment.GetName(), deployment.Kind)
 
+	if err := s.stampConfigHash(deploy, &deployment.Spec.Template); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	if deploy.RollbackOnFailure {
+		if err := s.restoreKnownGoodTemplate(deploy, deployment); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+	}
+
+	if s.isAutoscaled(deploy) {
+		deployment.Spec.Replicas = nil
+		deploy.beforeWrite = preserveReplicas(deploy.Replicas)
+		deploy.autoscaled = true
+	}
+
 	deploy.DesiredState = deployment
 	deploy.CurrentState = &appsv1.Deployment{}
 
@@ -168,6 +383,25 @@ func (s *Builder) buildDeployment(deploy BuilderDeploymentStatefulSet) (controll
 	return result, nil
 }
 
+func (s *Builder) buildDaemonSet(daemon BuilderDeploymentStatefulSet) (controllerutil.OperationResult, error) {
+
+	daemonSet, err := daemon.makeDaemonSet()
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	s.Put(daemonSet.GetName(), daemonSet.Kind)
+
+	if err := s.stampConfigHash(daemon, &daemonSet.Spec.Template); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	daemon.DesiredState = daemonSet
+	daemon.CurrentState = &appsv1.DaemonSet{}
+
+	return daemon.CreateOrUpdate(s.Context.Context, s.Recorder)
+}
+
 func (s *Builder) buildStatefulset(statefulset BuilderDeploymentStatefulSet) (controllerutil.OperationResult, error) {
 
 	sts, err := statefulset.MakeStatefulSet()
@@ -176,6 +410,42 @@ func (s *Builder) buildStatefulset(statefulset BuilderDeploymentStatefulSet) (co
 	}
 
 	sts.Spec.VolumeClaimTemplates = statefulset.MakeVolumeClaimTemplates()
+	if statefulset.PvcRetentionPolicySupported && len(statefulset.VolumeClaimTemplate) > 0 {
+		sts.Spec.PersistentVolumeClaimRetentionPolicy = statefulset.makePvcRetentionPolicy()
+	}
+
+	s.Put(sts.GetName(), sts.Kind)
+
+	if err := s.stampConfigHash(statefulset, &sts.Spec.Template); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	recreating, err := s.expandVolumeClaimTemplates(statefulset, sts)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	if recreating {
+		return controllerutil.OperationResultUpdated, nil
+	}
+
+	var canaryProgressing bool
+	if statefulset.Canary != nil {
+		if canaryProgressing, err = s.applyCanary(statefulset, sts); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		statefulset.beforeWrite = keepCanaryState
+	}
+
+	var decommissioning bool
+	if s.isAutoscaled(statefulset) {
+		sts.Spec.Replicas = nil
+		statefulset.beforeWrite = chainBeforeWrite(statefulset.beforeWrite, preserveReplicas(statefulset.Replicas))
+		statefulset.autoscaled = true
+	} else if statefulset.ScaleDown != nil {
+		if decommissioning, err = s.applyScaleDown(statefulset, sts); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+	}
 
 	statefulset.DesiredState = sts
 	statefulset.CurrentState = &appsv1.StatefulSet{}
@@ -185,6 +455,12 @@ func (s *Builder) buildStatefulset(statefulset BuilderDeploymentStatefulSet) (co
 		return controllerutil.OperationResultNone, err
 	}
 
+	// a canary step soaking or pods being decommissioned are reported as an update, so the
+	// rollout is requeued
+	if result == controllerutil.OperationResultNone && (canaryProgressing || decommissioning) {
+		return controllerutil.OperationResultUpdated, nil
+	}
+
 	return result, nil
 }
 
@@ -198,9 +474,36 @@ func (b *BuilderDeploymentStatefulSet) MakeVolumeClaimTemplates() []v1.Persisten
 			return []v1.PersistentVolumeClaim{}
 		}
 
+		// pvcs created from the template carry the statefulset name, so the deletion
+		// policy can be enforced once the statefulset is removed.
+		if storage.DeletionPolicy != "" {
+			pvc.Annotations[statefulSetOwnerAnnotation] = b.ObjectMeta.Name
+		}
+
 		pvcs = append(pvcs, *pvc)
 
 	}
 
 	return pvcs
 }
+
+// makePvcRetentionPolicy deletes the pvcs along with the statefulset only when every volume
+// claim template asks for it, pvcs released by a scale down are always retained.
+func (b *BuilderDeploymentStatefulSet) makePvcRetentionPolicy() *appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy {
+	whenDeleted := appsv1.DeletePersistentVolumeClaimRetentionPolicyType
+	for _, storage := range b.VolumeClaimTemplate {
+		if storage.DeletionPolicy != StorageDeletionPolicyDelete {
+			whenDeleted = appsv1.RetainPersistentVolumeClaimRetentionPolicyType
+		}
+	}
+
+	return &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+		WhenDeleted: whenDeleted,
+		WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+	}
+}
+
+// unknownKindError is returned for node types whose Kind is not Deployment, Statefulset or DaemonSet.
+func unknownKindError(node BuilderDeploymentStatefulSet) error {
+	return fmt.Errorf("node type [%s] has unknown kind [%s], expected Deployment, Statefulset or DaemonSet", node.ObjectMeta.Name, node.Kind)
+}
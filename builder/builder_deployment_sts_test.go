@@ -0,0 +1,53 @@
+package builder
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+func TestReconcileDaemonSet(t *testing.T) {
+	cr := newTestCr()
+	orphan := &appsv1.DaemonSet{ObjectMeta: newTestObjectMeta(cr, "old-agent")}
+	c := newTestClient(orphan)
+
+	node := newTestNode(c, cr, "agent", "DaemonSet")
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{node}))
+
+	if _, err := b.ReconcileDeployOrSts(); err != nil {
+		t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+	}
+	if err := b.ReconcileStore(); err != nil {
+		t.Fatalf("ReconcileStore() error = %v", err)
+	}
+
+	daemonSet := &appsv1.DaemonSet{ObjectMeta: newTestObjectMeta(cr, "agent")}
+	if !exists(c, daemonSet) {
+		t.Fatalf("daemonset agent was not created or was garbage collected")
+	}
+	if got := daemonSet.Spec.Template.Spec.Containers[0].Image; got != "app:1" {
+		t.Errorf("image = %s, want app:1", got)
+	}
+	if exists(c, orphan) {
+		t.Errorf("orphaned daemonset old-agent was not garbage collected")
+	}
+}
+
+func TestReconcileDeployOrStsRejectsUnknownKind(t *testing.T) {
+	cr := newTestCr()
+	c := newTestClient()
+
+	nodes := []BuilderDeploymentStatefulSet{
+		newTestNode(c, cr, "broker", "Daemonset"),
+		newTestNode(c, cr, "router", "Deployment"),
+	}
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderDeploymentStatefulSet(nodes))
+
+	if _, err := b.ReconcileDeployOrSts(); err == nil {
+		t.Fatalf("ReconcileDeployOrSts() error = nil, want unknown kind error")
+	}
+	// node types after the rejected one are not rolled out
+	if exists(c, newTestDeployment(cr, "router")) {
+		t.Errorf("deployment router was created after the rejected node type")
+	}
+}
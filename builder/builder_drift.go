@@ -0,0 +1,193 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// isDrifted compares the fields set on the desired object with the live object. Fields
+// which are left unset on the desired object are ignored, so values defaulted or populated
+// by the api server are never reported as drift.
+func isDrifted(desired, current client.Object) (bool, error) {
+
+	desiredMap, err := toUnstructuredMap(desired)
+	if err != nil {
+		return false, err
+	}
+
+	currentMap, err := toUnstructuredMap(current)
+	if err != nil {
+		return false, err
+	}
+
+	// Only user managed metadata is compared.
+	for _, field := range []string{"labels", "annotations"} {
+		desiredField, _, _ := unstructured.NestedFieldNoCopy(desiredMap, "metadata", field)
+		currentField, _, _ := unstructured.NestedFieldNoCopy(currentMap, "metadata", field)
+		if !isSubset(desiredField, currentField) {
+			return true, nil
+		}
+	}
+
+	for key, value := range desiredMap {
+		switch key {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		if !isSubset(value, currentMap[key]) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func toUnstructuredMap(obj client.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(runtime.Unstructured); ok {
+		return u.UnstructuredContent(), nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+// quantityFields are the keys whose values map resource names to quantities.
+var quantityFields = map[string]bool{
+	"requests": true,
+	"limits":   true,
+	"capacity": true,
+	"hard":     true,
+}
+
+// isSubset reports whether every value set in desired is present in current. Lists of
+// named items are matched by name so items added by admission webhooks, such as injected
+// sidecars, are tolerated. Quantities are compared by value, so 1000m matches 1.
+func isSubset(desired, current interface{}) bool {
+
+	switch d := desired.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		if len(d) == 0 {
+			return true
+		}
+		c, ok := current.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range d {
+			if quantityFields[key] {
+				if !isQuantitySubset(value, c[key]) {
+					return false
+				}
+				continue
+			}
+			if !isSubset(value, c[key]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		if len(d) == 0 {
+			return true
+		}
+		c, ok := current.([]interface{})
+		if !ok {
+			return false
+		}
+		if named, ok := byName(d); ok {
+			if currentNamed, ok := byName(c); ok {
+				for name, value := range named {
+					if !isSubset(value, currentNamed[name]) {
+						return false
+					}
+				}
+				return true
+			}
+		}
+		if len(d) != len(c) {
+			return false
+		}
+		for i := range d {
+			if !isSubset(d[i], c[i]) {
+				return false
+			}
+		}
+		return true
+	case string:
+		if d == "" {
+			return true
+		}
+		return d == current
+	case bool:
+		if !d {
+			return true
+		}
+		return d == current
+	default:
+		return reflect.DeepEqual(desired, current)
+	}
+}
+
+// isQuantitySubset compares a map of resource quantities semantically, values which do not
+// parse as quantities are compared as is.
+func isQuantitySubset(desired, current interface{}) bool {
+
+	d, ok := desired.(map[string]interface{})
+	if !ok {
+		return isSubset(desired, current)
+	}
+	c, ok := current.(map[string]interface{})
+	if !ok {
+		return len(d) == 0
+	}
+
+	for name, value := range d {
+		desiredQuantity, err := parseQuantity(value)
+		if err != nil {
+			if !isSubset(value, c[name]) {
+				return false
+			}
+			continue
+		}
+		currentQuantity, err := parseQuantity(c[name])
+		if err != nil || desiredQuantity.Cmp(currentQuantity) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func parseQuantity(value interface{}) (resource.Quantity, error) {
+	switch v := value.(type) {
+	case string:
+		return resource.ParseQuantity(v)
+	case int64:
+		return *resource.NewQuantity(v, resource.DecimalSI), nil
+	case float64:
+		return resource.ParseQuantity(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return resource.Quantity{}, fmt.Errorf("value [%v] is not a quantity", value)
+	}
+}
+
+// byName indexes a list by the name field of its items, it returns false if any item is not named.
+func byName(list []interface{}) (map[string]interface{}, bool) {
+	named := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok || name == "" {
+			return nil, false
+		}
+		named[name] = item
+	}
+	return named, true
+}
@@ -0,0 +1,164 @@
+package builder
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func newTestPod(containers ...map[string]interface{}) *unstructured.Unstructured {
+	list := make([]interface{}, 0, len(containers))
+	for _, c := range containers {
+		list = append(list, c)
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":   "pod",
+			"labels": map[string]interface{}{"app": "test"},
+		},
+		"spec": map[string]interface{}{"containers": list},
+	}}
+}
+
+func container(name string, requests map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"name":      name,
+		"image":     "druid:" + name,
+		"resources": map[string]interface{}{"requests": requests},
+	}
+}
+
+func TestIsDrifted(t *testing.T) {
+
+	desired := newTestPod(container("broker", map[string]interface{}{"cpu": "1", "memory": "1Gi"}))
+
+	tests := []struct {
+		name    string
+		current *unstructured.Unstructured
+		drifted bool
+	}{
+		{
+			name:    "equal quantities in other units",
+			current: newTestPod(container("broker", map[string]interface{}{"cpu": "1000m", "memory": "1024Mi"})),
+		},
+		{
+			name:    "injected sidecar",
+			current: newTestPod(container("broker", map[string]interface{}{"cpu": "1", "memory": "1Gi"}), container("proxy", nil)),
+		},
+		{
+			name:    "changed quantity",
+			current: newTestPod(container("broker", map[string]interface{}{"cpu": "500m", "memory": "1Gi"})),
+			drifted: true,
+		},
+		{
+			name:    "removed request",
+			current: newTestPod(container("broker", map[string]interface{}{"cpu": "1"})),
+			drifted: true,
+		},
+		{
+			name:    "removed container",
+			current: newTestPod(container("proxy", nil)),
+			drifted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drifted, err := isDrifted(desired, tt.current)
+			if err != nil {
+				t.Fatalf("isDrifted() error = %v", err)
+			}
+			if drifted != tt.drifted {
+				t.Errorf("isDrifted() = %v, want %v", drifted, tt.drifted)
+			}
+		})
+	}
+
+	edited := desired.DeepCopy()
+	edited.SetLabels(map[string]string{"app": "edited"})
+	if drifted, _ := isDrifted(desired, edited); !drifted {
+		t.Error("isDrifted() = false for an edited label, want true")
+	}
+
+	defaulted := desired.DeepCopy()
+	defaulted.SetLabels(map[string]string{"app": "test", "pod-template-hash": "abc"})
+	unstructured.SetNestedField(defaulted.Object, "Always", "spec", "restartPolicy")
+	if drifted, _ := isDrifted(desired, defaulted); drifted {
+		t.Error("isDrifted() = true for server populated fields, want false")
+	}
+}
+
+func TestCreateOrUpdateRevertsDrift(t *testing.T) {
+
+	cr := newTestCr()
+	c := newTestClient()
+	recorder := newTestRecorder()
+
+	build := func() CommonBuilder {
+		b := newTestCommonBuilder(c, cr, "config")
+		b.DetectDrift = true
+		b.DesiredState = newTestConfigMap("config", map[string]string{"key": "value"})
+		b.CurrentState = &v1.ConfigMap{}
+		return b
+	}
+
+	b := build()
+	if _, err := b.CreateOrUpdate(context.Background(), recorder); err != nil {
+		t.Fatalf("CreateOrUpdate() error = %v", err)
+	}
+
+	// an edit outside the operator keeps the hash annotation
+	live := &v1.ConfigMap{}
+	if err := c.Get(context.Background(), objectKey("config"), live); err != nil {
+		t.Fatal(err)
+	}
+	live.Data["key"] = "edited"
+	if err := c.Update(context.Background(), live); err != nil {
+		t.Fatal(err)
+	}
+
+	b = build()
+	operation, err := b.CreateOrUpdate(context.Background(), recorder)
+	if err != nil {
+		t.Fatalf("CreateOrUpdate() error = %v", err)
+	}
+	if operation != controllerutil.OperationResultUpdated {
+		t.Errorf("CreateOrUpdate() = %s, want %s", operation, controllerutil.OperationResultUpdated)
+	}
+
+	_ = c.Get(context.Background(), objectKey("config"), live)
+	if live.Data["key"] != "value" {
+		t.Errorf("data = %q, want drift reverted", live.Data["key"])
+	}
+	if !hasEvent(recorder, "Drift") {
+		t.Error("no drift event recorded")
+	}
+
+	b = build()
+	if operation, _ := b.CreateOrUpdate(context.Background(), recorder); operation != controllerutil.OperationResultNone {
+		t.Errorf("CreateOrUpdate() = %s after revert, want %s", operation, controllerutil.OperationResultNone)
+	}
+}
+
+// hasEvent drains the fake recorder and reports whether an event with the reason suffix was recorded.
+func hasEvent(recorder BuilderRecorder, reason string) bool {
+	events := recorder.Recorder.(*record.FakeRecorder).Events
+	found := false
+	for {
+		select {
+		case event := <-events:
+			if strings.Contains(event, recorder.ControllerName+reason) {
+				found = true
+			}
+		default:
+			return found
+		}
+	}
+}
@@ -0,0 +1,497 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// healthGateWaitingAnnotationPrefix is prefixed to the node type name to record on the custom
+	// resource the workload generation the health gates wait for and since when.
+	healthGateWaitingAnnotationPrefix = "healthgate.operator-runtime.datainfra.io/"
+
+	healthGateCondition = "HealthGate"
+
+	defaultHealthGateCheckTimeout = 10 * time.Second
+
+	// deploymentRevisionAnnotation is set by the deployment controller on a deployment and on its
+	// replicasets, the replicaset of the current revision carries the revision of the deployment.
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+)
+
+// HealthGate checks the health of the application run by a node type once kubernetes reports
+// its pods ready, e.g. that historicals loaded their segments.
+type HealthGate interface {
+	// Check reports whether the application is healthy. An error is reported in the status
+	// condition and the check is retried on the next reconcile.
+	Check(ctx context.Context, target HealthGateTarget) (bool, error)
+}
+
+// HealthGateFunc adapts a function to a HealthGate.
+type HealthGateFunc func(ctx context.Context, target HealthGateTarget) (bool, error)
+
+func (f HealthGateFunc) Check(ctx context.Context, target HealthGateTarget) (bool, error) {
+	return f(ctx, target)
+}
+
+// HealthGateTarget is the node type a HealthGate checks.
+type HealthGateTarget struct {
+	// Workload is the live deployment, statefulset or daemonset.
+	Workload client.Object
+	// Services are the services built by the builder.
+	Services []BuilderService
+	Client   client.Client
+}
+
+// HealthGatePolicy holds the health gates of a node type, the node types after it are not rolled
+// out until every gate passed.
+type HealthGatePolicy struct {
+	Gates []HealthGate
+	// Timeout fails the rollout when the gates have not passed this long after the workload
+	// changed, zero waits forever.
+	Timeout time.Duration
+	// CheckTimeout bounds a single check, defaults to 10 seconds.
+	CheckTimeout time.Duration
+}
+
+// HealthGateTimeoutError is returned when the health gates of a node type did not pass in time.
+type HealthGateTimeoutError struct {
+	Name    string
+	Timeout time.Duration
+	Message string
+}
+
+func (e *HealthGateTimeoutError) Error() string {
+	return fmt.Sprintf("health gates of [%s] did not pass within [%s], Message [%s]", e.Name, e.Timeout, e.Message)
+}
+
+// IsHealthGateTimeoutError reports whether err, or any error it wraps, is a HealthGateTimeoutError.
+func IsHealthGateTimeoutError(err error) bool {
+	var timeoutErr *HealthGateTimeoutError
+	return errors.As(err, &timeoutErr)
+}
+
+// checkHealthGates runs the health gates of a node type whose workload is fully deployed and
+// reports the outcome as a "HealthGate.<name>" condition. Gates are run in order, the first one
+// which does not pass stops the check.
+func (s *Builder) checkHealthGates(node BuilderDeploymentStatefulSet) (bool, error) {
+
+	policy := node.HealthGates
+	if policy == nil || len(policy.Gates) == 0 {
+		return true, nil
+	}
+
+	conditionType := healthGateCondition + "." + node.ObjectMeta.Name
+	target := HealthGateTarget{
+		Workload: node.CurrentState,
+		Services: s.Service,
+		Client:   node.Client,
+	}
+
+	for i, gate := range policy.Gates {
+
+		healthy, err := runHealthGate(s.Context.Context, policy, gate, target)
+		if healthy {
+			continue
+		}
+
+		message := fmt.Sprintf("Health gate %s of [%s] has not passed", describeHealthGate(i, gate), node.ObjectMeta.Name)
+		if err != nil {
+			message = fmt.Sprintf("%s, %s", message, err.Error())
+		}
+
+		if policy.Timeout > 0 {
+			since, err := s.healthGateWaitingSince(node)
+			if err != nil {
+				return false, err
+			}
+			if time.Since(since) >= policy.Timeout {
+				timeoutErr := &HealthGateTimeoutError{Name: node.ObjectMeta.Name, Timeout: policy.Timeout, Message: message}
+				s.setCondition(conditionType, metav1.ConditionFalse, "TimedOut", timeoutErr.Error())
+				return false, timeoutErr
+			}
+		}
+
+		s.setCondition(conditionType, metav1.ConditionUnknown, "Waiting", message)
+		return false, nil
+	}
+
+	// a later failure of the gates starts a new wait
+	if err := node.removeCrAnnotations(s.Context.Context, healthGateWaitingAnnotationPrefix+node.ObjectMeta.Name); err != nil {
+		return false, err
+	}
+
+	s.setCondition(conditionType, metav1.ConditionTrue, "Healthy", fmt.Sprintf("Health gates of [%s] passed", node.ObjectMeta.Name))
+	return true, nil
+}
+
+// pruneHealthGateAnnotations removes the waits recorded on the custom resource for node types
+// which are gone or have no health gates anymore.
+func (s *Builder) pruneHealthGateAnnotations() error {
+
+	if s.Store.CrObject == nil || s.Store.Client == nil {
+		return nil
+	}
+
+	gated := make(map[string]bool, len(s.DeploymentOrStatefulset))
+	for _, node := range s.DeploymentOrStatefulset {
+		if node.HealthGates != nil && len(node.HealthGates.Gates) > 0 {
+			gated[healthGateWaitingAnnotationPrefix+node.ObjectMeta.Name] = true
+		}
+	}
+
+	var stale []string
+	for key := range s.Store.CrObject.GetAnnotations() {
+		if strings.HasPrefix(key, healthGateWaitingAnnotationPrefix) && !gated[key] {
+			stale = append(stale, key)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	return s.Store.removeCrAnnotations(s.Context.Context, stale...)
+}
+
+func runHealthGate(ctx context.Context, policy *HealthGatePolicy, gate HealthGate, target HealthGateTarget) (bool, error) {
+
+	timeout := policy.CheckTimeout
+	if timeout == 0 {
+		timeout = defaultHealthGateCheckTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return gate.Check(ctx, target)
+}
+
+func describeHealthGate(i int, gate HealthGate) string {
+	if stringer, ok := gate.(fmt.Stringer); ok {
+		return fmt.Sprintf("[%s]", stringer.String())
+	}
+	return fmt.Sprintf("[%d]", i)
+}
+
+// healthGateWaitingSince returns since when the health gates wait for the current generation of
+// the workload, the start is recorded on the custom resource so it survives operator restarts.
+// The record is removed once the gates pass.
+func (s *Builder) healthGateWaitingSince(node BuilderDeploymentStatefulSet) (time.Time, error) {
+
+	key := healthGateWaitingAnnotationPrefix + node.ObjectMeta.Name
+	generation := strconv.FormatInt(node.CurrentState.GetGeneration(), 10)
+
+	recorded := strings.SplitN(node.CrObject.GetAnnotations()[key], "/", 2)
+	if len(recorded) == 2 && recorded[0] == generation {
+		if since, err := time.Parse(time.RFC3339, recorded[1]); err == nil {
+			return since, nil
+		}
+	}
+
+	since := time.Now().UTC()
+	if err := node.annotateCr(s.Context.Context, key, generation+"/"+since.Format(time.RFC3339)); err != nil {
+		return time.Time{}, err
+	}
+	return since, nil
+}
+
+// HTTPHealthGate requests a status endpoint through a service built by BuilderService and
+// compares a JSONPath of the response with the expected value.
+type HTTPHealthGate struct {
+	// Service names the BuilderService the request is sent to.
+	Service string
+	// Port defaults to the first port of the service.
+	Port int32
+	Path string
+	// Scheme is http or https, defaults to http.
+	Scheme string
+	// JSONPath selects the value compared with Expected, e.g. {.cacheInitialized}. A successful
+	// response passes the gate when it is empty.
+	JSONPath string
+	Expected string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (g *HTTPHealthGate) String() string {
+	return fmt.Sprintf("GET %s on service %s", g.Path, g.Service)
+}
+
+func (g *HTTPHealthGate) Check(ctx context.Context, target HealthGateTarget) (bool, error) {
+
+	url, err := g.url(target)
+	if err != nil {
+		return false, err
+	}
+
+	if err := probeHTTP(ctx, g.HTTPClient, http.MethodGet, url, g.JSONPath, g.Expected); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (g *HTTPHealthGate) url(target HealthGateTarget) (string, error) {
+
+	for _, svc := range target.Services {
+		if svc.ObjectMeta.Name != g.Service || svc.ServiceSpec == nil {
+			continue
+		}
+
+		port := g.Port
+		if port == 0 {
+			if len(svc.ServiceSpec.Ports) == 0 {
+				return "", fmt.Errorf("service [%s] has no ports", g.Service)
+			}
+			port = svc.ServiceSpec.Ports[0].Port
+		}
+
+		namespace := svc.ObjectMeta.Namespace
+		if namespace == "" {
+			namespace = target.Workload.GetNamespace()
+		}
+
+		scheme := g.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+
+		return fmt.Sprintf("%s://%s.%s.svc:%d/%s", scheme, g.Service, namespace, port, strings.TrimPrefix(g.Path, "/")), nil
+	}
+
+	return "", fmt.Errorf("service [%s] is not built by the builder", g.Service)
+}
+
+// probeHTTP sends a request and compares the JSONPath of the json response with expected, any
+// successful response matches when jsonPath is empty.
+func probeHTTP(ctx context.Context, httpClient *http.Client, method, url, jsonPath, expected string) error {
+
+	request, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("[%s] returned status [%d]", url, response.StatusCode)
+	}
+
+	if jsonPath == "" {
+		return nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return fmt.Errorf("[%s] did not return json, %s", url, err.Error())
+	}
+
+	path := jsonpath.New(url)
+	if err := path.Parse(jsonPath); err != nil {
+		return err
+	}
+
+	var value bytes.Buffer
+	if err := path.Execute(&value, data); err != nil {
+		return err
+	}
+	if actual := strings.TrimSpace(value.String()); actual != expected {
+		return fmt.Errorf("%s of [%s] is [%s], expected [%s]", jsonPath, url, actual, expected)
+	}
+
+	return nil
+}
+
+// ExecHealthGate runs a command in every pod of the workload, the gate passes once the command
+// exits with 0 in all of them.
+type ExecHealthGate struct {
+	// Config is the rest config of the manager, the controller-runtime client cannot exec.
+	Config *rest.Config
+	// Container defaults to the first container of the pod.
+	Container string
+	Command   []string
+
+	client corev1client.CoreV1Interface
+}
+
+func (g *ExecHealthGate) String() string {
+	return fmt.Sprintf("exec %s", strings.Join(g.Command, " "))
+}
+
+func (g *ExecHealthGate) Check(ctx context.Context, target HealthGateTarget) (bool, error) {
+
+	if g.client == nil {
+		coreClient, err := corev1client.NewForConfig(g.Config)
+		if err != nil {
+			return false, err
+		}
+		g.client = coreClient
+	}
+
+	pods, err := workloadPods(ctx, target.Client, target.Workload)
+	if err != nil {
+		return false, err
+	}
+	if len(pods) == 0 {
+		return false, nil
+	}
+
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || !isPodReady(&pod) {
+			return false, fmt.Errorf("pod [%s] is not ready", pod.GetName())
+		}
+		if err := g.exec(ctx, &pod); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (g *ExecHealthGate) exec(ctx context.Context, pod *v1.Pod) error {
+
+	request := g.client.RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.GetNamespace()).
+		Name(pod.GetName()).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: g.Container,
+			Command:   g.Command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(g.Config, http.MethodPost, request.URL())
+	if err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("command exited with [%d] in pod [%s], %s", exitErr.ExitStatus(), pod.GetName(), strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// workloadPods returns the pods of the current replicaset of a deployment, or the pods controlled
+// by a statefulset or daemonset. Node types may share their labels, so the pods are scoped to the
+// workload rather than selected by its labels only.
+func workloadPods(ctx context.Context, c client.Client, workload client.Object) ([]v1.Pod, error) {
+
+	selector, err := workloadSelector(workload, schemeOf(c))
+	if err != nil {
+		return nil, err
+	}
+
+	owner := workload
+	if deploy, ok := workload.(*appsv1.Deployment); ok {
+		replicaSet, err := currentReplicaSet(ctx, c, deploy, selector)
+		if err != nil || replicaSet == nil {
+			return nil, err
+		}
+		owner = replicaSet
+
+		// the pod-template-hash label tells the pods of the current revision apart
+		hash, err := labels.NewRequirement(appsv1.DefaultDeploymentUniqueLabelKey, selection.Equals, []string{replicaSet.GetLabels()[appsv1.DefaultDeploymentUniqueLabelKey]})
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*hash)
+	}
+
+	pods := &v1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(workload.GetNamespace()), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	var owned []v1.Pod
+	for _, pod := range pods.Items {
+		if metav1.IsControlledBy(&pod, owner) {
+			owned = append(owned, pod)
+		}
+	}
+	return owned, nil
+}
+
+// currentReplicaSet returns the replicaset of the current revision of a deployment, nil when the
+// deployment controller did not create it yet.
+func currentReplicaSet(ctx context.Context, c client.Client, deploy *appsv1.Deployment, selector labels.Selector) (*appsv1.ReplicaSet, error) {
+
+	replicaSets := &appsv1.ReplicaSetList{}
+	if err := c.List(ctx, replicaSets, client.InNamespace(deploy.GetNamespace()), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	revision := deploy.GetAnnotations()[deploymentRevisionAnnotation]
+	for i := range replicaSets.Items {
+		replicaSet := &replicaSets.Items[i]
+		if metav1.IsControlledBy(replicaSet, deploy) && replicaSet.GetAnnotations()[deploymentRevisionAnnotation] == revision {
+			return replicaSet, nil
+		}
+	}
+	return nil, nil
+}
+
+// workloadSelector returns the pod selector of a deployment, statefulset or daemonset.
+func workloadSelector(obj client.Object, objScheme *runtime.Scheme) (labels.Selector, error) {
+
+	var selector *metav1.LabelSelector
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		selector = obj.Spec.Selector
+	case *appsv1.StatefulSet:
+		selector = obj.Spec.Selector
+	case *appsv1.DaemonSet:
+		selector = obj.Spec.Selector
+	default:
+		return nil, fmt.Errorf("[%s] is not a workload", detectType(obj, objScheme))
+	}
+
+	return metav1.LabelSelectorAsSelector(selector)
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestCheckHealthGates(t *testing.T) {
+
+	passing := HealthGateFunc(func(ctx context.Context, target HealthGateTarget) (bool, error) { return true, nil })
+	failing := HealthGateFunc(func(ctx context.Context, target HealthGateTarget) (bool, error) {
+		return false, errors.New("segments loading")
+	})
+
+	key := healthGateWaitingAnnotationPrefix + "historical"
+	hourAgo := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name     string
+		gate     HealthGate
+		timeout  time.Duration
+		recorded string
+		healthy  bool
+		timedOut bool
+		waiting  bool
+		reason   string
+	}{
+		{
+			name:    "gates pass",
+			gate:    passing,
+			timeout: time.Minute,
+			healthy: true,
+			reason:  "Healthy",
+		},
+		{
+			name:     "passing gates clear the wait",
+			gate:     passing,
+			timeout:  time.Minute,
+			recorded: "2/" + hourAgo,
+			healthy:  true,
+			reason:   "Healthy",
+		},
+		{
+			name:    "failing gates start a wait",
+			gate:    failing,
+			timeout: time.Minute,
+			waiting: true,
+			reason:  "Waiting",
+		},
+		{
+			name:     "failing gates time out",
+			gate:     failing,
+			timeout:  time.Minute,
+			recorded: "2/" + hourAgo,
+			timedOut: true,
+			waiting:  true,
+			reason:   "TimedOut",
+		},
+		{
+			name:     "a new generation starts a new wait",
+			gate:     failing,
+			timeout:  time.Minute,
+			recorded: "1/" + hourAgo,
+			waiting:  true,
+			reason:   "Waiting",
+		},
+		{
+			name:   "failing gates without a timeout wait forever",
+			gate:   failing,
+			reason: "Waiting",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			cr := newTestCr()
+			if tt.recorded != "" {
+				cr.SetAnnotations(map[string]string{key: tt.recorded})
+			}
+			c := newTestClient(cr.DeepCopy())
+
+			live := newTestDeployment(cr, "historical")
+			live.Generation = 2
+
+			node := newTestNode(c, cr, "historical", "Deployment")
+			node.HealthGates = &HealthGatePolicy{Gates: []HealthGate{tt.gate}, Timeout: tt.timeout}
+			node.CurrentState = live
+
+			b := newTestBuilder(c, cr, newTestRecorder())
+
+			healthy, err := b.checkHealthGates(node)
+			if healthy != tt.healthy {
+				t.Errorf("healthy = %v, want %v", healthy, tt.healthy)
+			}
+			if timedOut := IsHealthGateTimeoutError(err); timedOut != tt.timedOut {
+				t.Errorf("timed out = %v, want %v, error = %v", timedOut, tt.timedOut, err)
+			}
+			if err != nil && !tt.timedOut {
+				t.Fatalf("checkHealthGates() error = %v", err)
+			}
+
+			condition := meta.FindStatusCondition(b.Status.Conditions, healthGateCondition+".historical")
+			if condition == nil || condition.Reason != tt.reason {
+				t.Errorf("condition = %v, want reason %s", condition, tt.reason)
+			}
+
+			stored := newTestCr()
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(stored), stored); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			recorded, waiting := stored.GetAnnotations()[key]
+			if waiting != tt.waiting {
+				t.Errorf("wait recorded = %v, want %v", waiting, tt.waiting)
+			}
+			if waiting && recorded[:2] != "2/" {
+				t.Errorf("wait recorded for [%s], want generation 2", recorded)
+			}
+		})
+	}
+}
+
+func TestPruneHealthGateAnnotations(t *testing.T) {
+
+	cr := newTestCr()
+	cr.SetAnnotations(map[string]string{
+		healthGateWaitingAnnotationPrefix + "historical": "1/2026-01-01T00:00:00Z",
+		healthGateWaitingAnnotationPrefix + "broker":     "1/2026-01-01T00:00:00Z",
+		healthGateWaitingAnnotationPrefix + "removed":    "1/2026-01-01T00:00:00Z",
+		"unrelated": "kept",
+	})
+	c := newTestClient(cr.DeepCopy())
+
+	gated := newTestNode(c, cr, "historical", "Deployment")
+	gated.HealthGates = &HealthGatePolicy{Gates: []HealthGate{HealthGateFunc(func(ctx context.Context, target HealthGateTarget) (bool, error) { return true, nil })}}
+	ungated := newTestNode(c, cr, "broker", "Deployment")
+
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{gated, ungated}))
+	if err := b.pruneHealthGateAnnotations(); err != nil {
+		t.Fatalf("pruneHealthGateAnnotations() error = %v", err)
+	}
+
+	stored := newTestCr()
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(stored), stored); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	tests := []struct {
+		key  string
+		kept bool
+	}{
+		{key: healthGateWaitingAnnotationPrefix + "historical", kept: true},
+		{key: healthGateWaitingAnnotationPrefix + "broker"},
+		{key: healthGateWaitingAnnotationPrefix + "removed"},
+		{key: "unrelated", kept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if _, kept := stored.GetAnnotations()[tt.key]; kept != tt.kept {
+				t.Errorf("annotation kept = %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestWorkloadPodsAreScopedToTheWorkload(t *testing.T) {
+
+	cr := newTestCr()
+	trueVar := true
+	controlledBy := func(obj client.Object, kind string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: kind, Name: obj.GetName(), UID: obj.GetUID(), Controller: &trueVar}}
+	}
+	withHash := func(hash string) map[string]string {
+		return map[string]string{"app": "test", appsv1.DefaultDeploymentUniqueLabelKey: hash}
+	}
+
+	// both node types share the store labels
+	broker := newTestDeployment(cr, "broker")
+	broker.UID = "broker-uid"
+	broker.Annotations = map[string]string{deploymentRevisionAnnotation: "2"}
+	data := newTestStatefulSet(cr, "data")
+	data.UID = "data-uid"
+
+	replicaSet := func(name, hash, revision string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       testNamespace,
+			UID:             types.UID(name + "-uid"),
+			Labels:          withHash(hash),
+			Annotations:     map[string]string{deploymentRevisionAnnotation: revision},
+			OwnerReferences: controlledBy(broker, "Deployment"),
+		}}
+	}
+	previous := replicaSet("broker-old", "old", "1")
+	current := replicaSet("broker-new", "new", "2")
+
+	pod := func(name string, labels map[string]string, owner client.Object, kind string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: labels, OwnerReferences: controlledBy(owner, kind)}}
+	}
+
+	c := newTestClient(broker, data, previous, current,
+		pod("broker-old-1", withHash("old"), previous, "ReplicaSet"),
+		pod("broker-new-1", withHash("new"), current, "ReplicaSet"),
+		pod("data-0", testLabels, data, "StatefulSet"),
+	)
+
+	tests := []struct {
+		name     string
+		workload client.Object
+		pods     []string
+	}{
+		{
+			name:     "deployment selects the pods of its current replicaset",
+			workload: broker,
+			pods:     []string{"broker-new-1"},
+		},
+		{
+			name:     "statefulset selects the pods it controls",
+			workload: data,
+			pods:     []string{"data-0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pods, err := workloadPods(context.Background(), c, tt.workload)
+			if err != nil {
+				t.Fatalf("workloadPods() error = %v", err)
+			}
+			var names []string
+			for _, pod := range pods {
+				names = append(names, pod.GetName())
+			}
+			if !reflect.DeepEqual(names, tt.pods) {
+				t.Errorf("pods = %v, want %v", names, tt.pods)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type BuilderHPA struct {
+	HPASpec *autoscalingv2.HorizontalPodAutoscalerSpec
+	CommonBuilder
+}
+
+func ToNewBuilderHPA(builder []BuilderHPA) func(*Builder) {
+	return func(s *Builder) {
+		s.HPA = builder
+	}
+}
+
+func (s *Builder) ReconcileHPA() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(hpa))
+
+	for _, autoscaler := range s.HPA {
+
+		if autoscaler.HPASpec != nil {
+
+			makeHpa := autoscaler.makeHPA()
+
+			s.Put(makeHpa.GetName(), makeHpa.Kind)
+
+			autoscaler.DesiredState = makeHpa
+			autoscaler.CurrentState = &autoscalingv2.HorizontalPodAutoscaler{}
+
+			operation, err := autoscaler.CreateOrUpdate(s.Context.Context, s.Recorder)
+			result.add(makeHpa.Kind, makeHpa.GetName(), operation, err)
+		}
+	}
+
+	return result, result.Err()
+}
+
+func (b *BuilderHPA) makeHPA() *autoscalingv2.HorizontalPodAutoscaler {
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "autoscaling/v2",
+			Kind:       "HorizontalPodAutoscaler",
+		},
+		ObjectMeta: b.ObjectMeta,
+		Spec:       *b.HPASpec,
+	}
+}
+
+// isAutoscaled reports whether the replicas of a node type are owned by an autoscaler, either
+// a BuilderHPA targeting it or one managed outside the runtime.
+func (s *Builder) isAutoscaled(node BuilderDeploymentStatefulSet) bool {
+
+	if node.ReplicasManagedExternally {
+		return true
+	}
+
+	for _, autoscaler := range s.HPA {
+		if autoscaler.HPASpec == nil {
+			continue
+		}
+		target := autoscaler.HPASpec.ScaleTargetRef
+		if target.Name == node.ObjectMeta.Name && target.Kind == workloadKind(node) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// preserveReplicas keeps the replica count of the live workload when it is updated, the initial
+// replicas are only used when the workload is created.
+func preserveReplicas(initial int32) func(desired, current client.Object) {
+	return func(desired, current client.Object) {
+
+		replicas := &initial
+		switch current := current.(type) {
+		case *appsv1.Deployment:
+			if current.Spec.Replicas != nil {
+				replicas = current.Spec.Replicas
+			}
+		case *appsv1.StatefulSet:
+			if current.Spec.Replicas != nil {
+				replicas = current.Spec.Replicas
+			}
+		}
+
+		switch desired := desired.(type) {
+		case *appsv1.Deployment:
+			desired.Spec.Replicas = replicas
+		case *appsv1.StatefulSet:
+			desired.Spec.Replicas = replicas
+		}
+	}
+}
+
+// replicasHandoverSuffix is appended to the apply field manager to name the manager which keeps
+// spec.replicas of an autoscaled workload once the runtime stops applying it.
+const replicasHandoverSuffix = "-replicas-handover"
+
+// handOverReplicas moves spec.replicas from the apply field manager to a handover manager. A field
+// left out of an apply patch is removed when no other manager owns it, which would reset the
+// replicas before the autoscaler took them over.
+func (b *CommonBuilder) handOverReplicas(ctx context.Context, fieldManager string) error {
+
+	if !ownsReplicas(b.CurrentState, fieldManager) {
+		return nil
+	}
+
+	var replicas *int32
+	switch current := b.CurrentState.(type) {
+	case *appsv1.Deployment:
+		replicas = current.Spec.Replicas
+	case *appsv1.StatefulSet:
+		replicas = current.Spec.Replicas
+	}
+	if replicas == nil {
+		return nil
+	}
+
+	handover := &unstructured.Unstructured{}
+	handover.SetGroupVersionKind(b.DesiredState.GetObjectKind().GroupVersionKind())
+	handover.SetName(b.DesiredState.GetName())
+	handover.SetNamespace(b.DesiredState.GetNamespace())
+	if err := unstructured.SetNestedField(handover.Object, int64(*replicas), "spec", "replicas"); err != nil {
+		return err
+	}
+
+	return b.Client.Patch(ctx, handover, client.Apply, client.FieldOwner(fieldManager+replicasHandoverSuffix))
+}
+
+// ownsReplicas reports whether the field manager applied spec.replicas of the object.
+func ownsReplicas(obj client.Object, fieldManager string) bool {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != fieldManager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		if _, ok := fields["f:spec"]["f:replicas"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// clearReplicas leaves spec.replicas out of the desired workload.
+func clearReplicas(obj client.Object) {
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		obj.Spec.Replicas = nil
+	case *appsv1.StatefulSet:
+		obj.Spec.Replicas = nil
+	}
+}
@@ -0,0 +1,116 @@
+package builder
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestHPA(c client.Client, cr client.Object, target string) BuilderHPA {
+	minReplicas := int32(2)
+	return BuilderHPA{
+		HPASpec: &autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: target},
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    10,
+		},
+		CommonBuilder: newTestCommonBuilder(c, cr, target),
+	}
+}
+
+func TestAutoscaledDeploymentKeepsLiveReplicas(t *testing.T) {
+
+	cr := newTestCr()
+	c := newTestClient(cr.DeepCopy())
+
+	reconcile := func(image string) *appsv1.Deployment {
+		t.Helper()
+		node := newTestNode(c, cr, "broker", "Deployment")
+		node.Replicas = 2
+		node.PodSpec.Containers[0].Image = image
+		b := newTestBuilder(c, cr, newTestRecorder(),
+			ToNewBuilderHPA([]BuilderHPA{newTestHPA(c, cr, "broker")}),
+			ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{node}),
+		)
+		if _, err := b.ReconcileHPA(); err != nil {
+			t.Fatalf("ReconcileHPA() error = %v", err)
+		}
+		if _, err := b.ReconcileDeployOrSts(); err != nil {
+			t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+		}
+		live := &appsv1.Deployment{}
+		if err := c.Get(context.Background(), objectKey("broker"), live); err != nil {
+			t.Fatal(err)
+		}
+		return live
+	}
+
+	created := reconcile("app:1")
+	if created.Spec.Replicas == nil || *created.Spec.Replicas != 2 {
+		t.Fatalf("replicas = %v on create, want the initial 2", created.Spec.Replicas)
+	}
+	if !exists(c, &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "broker", Namespace: testNamespace}}) {
+		t.Error("hpa was not created")
+	}
+
+	// the autoscaler scales the deployment
+	scaled := int32(5)
+	created.Spec.Replicas = &scaled
+	if err := c.Update(context.Background(), created); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := reconcile("app:2")
+	if updated.Spec.Template.Spec.Containers[0].Image != "app:2" {
+		t.Fatalf("image = %s, want the deployment updated", updated.Spec.Template.Spec.Containers[0].Image)
+	}
+	if updated.Spec.Replicas == nil || *updated.Spec.Replicas != scaled {
+		t.Errorf("replicas = %v after an update, want the autoscaled %d", updated.Spec.Replicas, scaled)
+	}
+}
+
+func TestApplyHandsOverReplicasOfAutoscaledWorkloads(t *testing.T) {
+
+	cr := newTestCr()
+	replicas := int32(4)
+
+	live := newTestDeployment(cr, "broker")
+	live.Spec.Replicas = &replicas
+	live.ManagedFields = []metav1.ManagedFieldsEntry{{
+		Manager:   "Test",
+		Operation: metav1.ManagedFieldsOperationApply,
+		FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{}}}`)},
+	}}
+
+	c := &applyRecordingClient{Client: newTestClient(live)}
+
+	desired := newTestDeployment(cr, "broker")
+	desired.TypeMeta = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}
+	desired.Spec.Template.Spec.Containers = []v1.Container{{Name: "app", Image: "app:2"}}
+
+	b := newTestCommonBuilder(c, cr, "broker")
+	b.ServerSideApply = &ServerSideApply{}
+	b.DesiredState = desired
+	b.CurrentState = &appsv1.Deployment{}
+	b.beforeWrite = preserveReplicas(1)
+	b.autoscaled = true
+
+	if _, err := b.CreateOrUpdate(context.Background(), newTestRecorder()); err != nil {
+		t.Fatalf("CreateOrUpdate() error = %v", err)
+	}
+
+	if len(c.applied) != 2 {
+		t.Fatalf("%d patches applied, want the handover and the update", len(c.applied))
+	}
+	if manager := c.options[0].FieldManager; manager != "Test"+replicasHandoverSuffix {
+		t.Errorf("handover field manager = %q, want %q", manager, "Test"+replicasHandoverSuffix)
+	}
+	if applied := c.applied[1].(*appsv1.Deployment); applied.Spec.Replicas != nil {
+		t.Errorf("applied replicas = %d, want them left out", *applied.Spec.Replicas)
+	}
+}
@@ -0,0 +1,122 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ImmutableFieldPolicy decides what CreateOrUpdate does when the api server rejects an update
+// because it changes immutable fields.
+type ImmutableFieldPolicy string
+
+const (
+	// ImmutableFieldPolicyFail returns an ImmutableFieldError, this is the default.
+	ImmutableFieldPolicyFail ImmutableFieldPolicy = "Fail"
+	// ImmutableFieldPolicyRecreate deletes the object with orphan propagation, so dependents such
+	// as pods keep running, and recreates it with the desired state on a following reconcile.
+	// PersistentVolumeClaims are not recreated, their updates fail as with ImmutableFieldPolicyFail.
+	ImmutableFieldPolicyRecreate ImmutableFieldPolicy = "Recreate"
+	// ImmutableFieldPolicyRecreateIncludingClaims recreates PersistentVolumeClaims as well, the data
+	// of a recreated pvc is lost.
+	ImmutableFieldPolicyRecreateIncludingClaims ImmutableFieldPolicy = "RecreateIncludingClaims"
+)
+
+// ImmutableFieldError is returned when an update is rejected because it changes immutable fields.
+type ImmutableFieldError struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Fields    []string
+	Err       error
+}
+
+func (e *ImmutableFieldError) Error() string {
+	return fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], immutable fields [%s] changed: %s", e.Name, e.Namespace, e.Kind, strings.Join(e.Fields, ", "), e.Err.Error())
+}
+
+func (e *ImmutableFieldError) Unwrap() error { return e.Err }
+
+// IsImmutableFieldError reports whether err is caused by a change of immutable fields.
+func IsImmutableFieldError(err error) bool {
+	var immutableErr *ImmutableFieldError
+	return errors.As(err, &immutableErr)
+}
+
+// immutableFields returns the fields named by an Invalid error when they are rejected for being immutable.
+func immutableFields(err error) ([]string, bool) {
+	if !apierrors.IsInvalid(err) {
+		return nil, false
+	}
+
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return nil, false
+	}
+
+	var fields []string
+	for _, cause := range status.Status().Details.Causes {
+		// statefulsets reject every spec change besides a few fields as forbidden
+		if strings.Contains(cause.Message, "immutable") || strings.Contains(cause.Message, "updates to statefulset spec") {
+			fields = append(fields, cause.Field)
+		}
+	}
+
+	return fields, len(fields) > 0
+}
+
+// handleUpdateError applies the immutable field policy to an update error, other errors are returned as is.
+func (b *CommonBuilder) handleUpdateError(ctx context.Context, buildRecorder BuilderRecorder, err error) (controllerutil.OperationResult, error) {
+
+	fields, ok := immutableFields(err)
+	if !ok {
+		return controllerutil.OperationResultNone, err
+	}
+
+	if !b.isRecreateAllowed() {
+		return controllerutil.OperationResultNone, &ImmutableFieldError{
+			Kind:      detectType(b.DesiredState, schemeOf(b.Client)),
+			Name:      b.DesiredState.GetName(),
+			Namespace: b.DesiredState.GetNamespace(),
+			Fields:    fields,
+			Err:       err,
+		}
+	}
+
+	if err := b.orphanDelete(ctx, buildRecorder, b.CurrentState); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	buildRecorder.recreateEvent(b.CrObject, b.CurrentState, fields)
+
+	return controllerutil.OperationResultUpdated, nil
+}
+
+// isRecreateAllowed reports whether the immutable field policy recreates the desired object.
+func (b *CommonBuilder) isRecreateAllowed() bool {
+	switch b.ImmutableFieldPolicy {
+	case ImmutableFieldPolicyRecreateIncludingClaims:
+		return true
+	case ImmutableFieldPolicyRecreate:
+		_, isClaim := b.DesiredState.(*v1.PersistentVolumeClaim)
+		return !isClaim
+	}
+	return false
+}
+
+// orphanDelete deletes the object without deleting its dependents.
+func (b *CommonBuilder) orphanDelete(ctx context.Context, buildRecorder BuilderRecorder, obj client.Object) error {
+	orphan := metav1.DeletePropagationOrphan
+	if err := b.Client.Delete(ctx, obj, &client.DeleteOptions{PropagationPolicy: &orphan}); err != nil {
+		buildRecorder.deleteEvent(b.CrObject, obj, err)
+		return err
+	}
+	buildRecorder.deleteEvent(b.CrObject, obj, nil)
+	return nil
+}
@@ -0,0 +1,156 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// rejectingClient fails every update with err and records the propagation of deletes.
+type rejectingClient struct {
+	client.Client
+	err         error
+	propagation *metav1.DeletionPropagation
+}
+
+func (c *rejectingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return c.err
+}
+
+func (c *rejectingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.propagation = (&client.DeleteOptions{}).ApplyOptions(opts).PropagationPolicy
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func immutableErr(kind, name string) error {
+	return apierrors.NewInvalid(schema.GroupKind{Kind: kind}, name, field.ErrorList{
+		field.Invalid(field.NewPath("spec", "selector"), nil, "field is immutable"),
+	})
+}
+
+func TestCreateOrUpdateImmutableFieldPolicy(t *testing.T) {
+
+	cr := newTestCr()
+
+	claim := func() (client.Object, client.Object) {
+		obj := &v1.PersistentVolumeClaim{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+			ObjectMeta: metav1.ObjectMeta{Name: "object", Namespace: testNamespace},
+			Spec:       newTestClaimSpec("1Gi", "standard"),
+		}
+		return obj, &v1.PersistentVolumeClaim{}
+	}
+	configMap := func() (client.Object, client.Object) {
+		return newTestConfigMap("object", map[string]string{"key": "value"}), &v1.ConfigMap{}
+	}
+
+	tests := []struct {
+		name       string
+		object     func() (client.Object, client.Object)
+		policy     ImmutableFieldPolicy
+		err        error
+		operation  controllerutil.OperationResult
+		immutable  bool
+		recreating bool
+	}{
+		{
+			name:      "fail by default",
+			object:    configMap,
+			err:       immutableErr("ConfigMap", "object"),
+			operation: controllerutil.OperationResultNone,
+			immutable: true,
+		},
+		{
+			name:       "recreate",
+			object:     configMap,
+			policy:     ImmutableFieldPolicyRecreate,
+			err:        immutableErr("ConfigMap", "object"),
+			operation:  controllerutil.OperationResultUpdated,
+			recreating: true,
+		},
+		{
+			name:      "recreate keeps claims",
+			object:    claim,
+			policy:    ImmutableFieldPolicyRecreate,
+			err:       immutableErr("PersistentVolumeClaim", "object"),
+			operation: controllerutil.OperationResultNone,
+			immutable: true,
+		},
+		{
+			name:       "recreate including claims",
+			object:     claim,
+			policy:     ImmutableFieldPolicyRecreateIncludingClaims,
+			err:        immutableErr("PersistentVolumeClaim", "object"),
+			operation:  controllerutil.OperationResultUpdated,
+			recreating: true,
+		},
+		{
+			name:      "other errors are returned as is",
+			object:    configMap,
+			policy:    ImmutableFieldPolicyRecreate,
+			err:       apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "object", errors.New("conflict")),
+			operation: controllerutil.OperationResultNone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// the live object carries no hash, so the desired state is always updated
+			live, _ := tt.object()
+			c := &rejectingClient{Client: newTestClient(live), err: tt.err}
+
+			desired, current := tt.object()
+			b := newTestCommonBuilder(c, cr, "object")
+			b.ImmutableFieldPolicy = tt.policy
+			b.DesiredState = desired
+			b.CurrentState = current
+
+			operation, err := b.CreateOrUpdate(context.Background(), newTestRecorder())
+			if operation != tt.operation {
+				t.Errorf("CreateOrUpdate() = %q, want %q", operation, tt.operation)
+			}
+			if IsImmutableFieldError(err) != tt.immutable {
+				t.Errorf("CreateOrUpdate() error = %v, want immutable field error %v", err, tt.immutable)
+			}
+			if !tt.recreating && !errors.Is(err, tt.err) {
+				t.Errorf("CreateOrUpdate() error = %v, want it to wrap %v", err, tt.err)
+			}
+
+			live, _ = tt.object()
+			if deleted := !exists(c, live); deleted != tt.recreating {
+				t.Fatalf("object deleted = %v, want %v", deleted, tt.recreating)
+			}
+			if tt.recreating && (c.propagation == nil || *c.propagation != metav1.DeletePropagationOrphan) {
+				t.Errorf("delete propagation = %v, want %s", c.propagation, metav1.DeletePropagationOrphan)
+			}
+		})
+	}
+}
+
+func TestCreateOrUpdateWaitsForRecreate(t *testing.T) {
+
+	live := newTestConfigMap("object", nil)
+	live.Finalizers = []string{"test"}
+	c := newTestClient(live)
+	if err := c.Delete(context.Background(), live); err != nil {
+		t.Fatal(err)
+	}
+
+	b := newTestCommonBuilder(c, newTestCr(), "object")
+	b.DesiredState = newTestConfigMap("object", map[string]string{"key": "value"})
+	b.CurrentState = &v1.ConfigMap{}
+
+	operation, err := b.CreateOrUpdate(context.Background(), newTestRecorder())
+	if err != nil || operation != controllerutil.OperationResultNone {
+		t.Errorf("CreateOrUpdate() = %q, %v, want no update while the object is deleted", operation, err)
+	}
+}
@@ -0,0 +1,127 @@
+package builder
+
+import (
+	"fmt"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+type BuilderIngress struct {
+	IngressSpec *networkingv1.IngressSpec
+	// Backend appends a rule routing to a service built by BuilderService.
+	Backend *ServiceBackend
+	CommonBuilder
+}
+
+// ServiceBackend derives a routing backend from a BuilderService, so backend names and ports
+// stay consistent with the service.
+type ServiceBackend struct {
+	Service *BuilderService
+	// PortName selects the service port, the first port is used when empty.
+	PortName string
+	Host     string
+	// Path defaults to "/" and is matched by prefix.
+	Path string
+}
+
+func ToNewBuilderIngress(builder []BuilderIngress) func(*Builder) {
+	return func(s *Builder) {
+		s.Ingress = builder
+	}
+}
+
+func (s *Builder) ReconcileIngress() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(ingress))
+
+	for _, ing := range s.Ingress {
+
+		makeIngress, err := ing.makeIngress()
+		if err != nil {
+			result.add(string(ingress), ing.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			continue
+		}
+
+		s.Put(makeIngress.GetName(), makeIngress.Kind)
+
+		ing.DesiredState = makeIngress
+		ing.CurrentState = &networkingv1.Ingress{}
+
+		operation, err := ing.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(makeIngress.Kind, makeIngress.GetName(), operation, err)
+	}
+
+	return result, result.Err()
+}
+
+func (b *BuilderIngress) makeIngress() (*networkingv1.Ingress, error) {
+
+	spec := networkingv1.IngressSpec{}
+	if b.IngressSpec != nil {
+		spec = *b.IngressSpec.DeepCopy()
+	}
+
+	if b.Backend != nil {
+		serviceName, port, err := b.Backend.servicePort()
+		if err != nil {
+			return nil, err
+		}
+
+		pathType := networkingv1.PathTypePrefix
+		spec.Rules = append(spec.Rules, networkingv1.IngressRule{
+			Host: b.Backend.Host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{
+						{
+							Path:     b.Backend.path(),
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: serviceName,
+									Port: networkingv1.ServiceBackendPort{Number: port},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+
+	return &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "networking.k8s.io/v1",
+			Kind:       "Ingress",
+		},
+		ObjectMeta: b.ObjectMeta,
+		Spec:       spec,
+	}, nil
+}
+
+// servicePort resolves the name and port number of the backend service.
+func (b *ServiceBackend) servicePort() (string, int32, error) {
+
+	if b.Service == nil || b.Service.ServiceSpec == nil {
+		return "", 0, fmt.Errorf("backend service is not set")
+	}
+
+	for _, port := range b.Service.ServiceSpec.Ports {
+		if b.PortName == "" || port.Name == b.PortName {
+			return b.Service.ObjectMeta.Name, port.Port, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("service [%s] has no port [%s]", b.Service.ObjectMeta.Name, b.PortName)
+}
+
+func (b *ServiceBackend) path() string {
+	if b.Path == "" {
+		return "/"
+	}
+	return b.Path
+}
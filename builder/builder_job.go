@@ -0,0 +1,301 @@
+package builder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// jobSucceededAnnotationPrefix is prefixed to the job name to record on the custom resource the spec
+// hash of its last successful run, the record outlives the job when it is cleaned up by its ttl.
+const jobSucceededAnnotationPrefix = "job.operator-runtime.datainfra.io/"
+
+// jobFailureReportedAnnotation marks a failed job whose failure has been evented, the job name
+// carries the spec hash so the failure of every spec is evented once.
+const jobFailureReportedAnnotation = "operator-runtime.datainfra.io/failure-reported"
+
+// jobHashLength is the length of the spec hash suffixed to job names.
+const jobHashLength = 10
+
+// maxJobNameLength keeps job names within the 63 characters of the job-name label set on their
+// pods, the same reason cronjob names are limited to 52 characters.
+const maxJobNameLength = 63
+
+// BuilderJob runs a job once per spec, the job is named after the hash of its spec and only runs
+// again when the spec changes.
+type BuilderJob struct {
+	JobSpec *batchv1.JobSpec
+	// TTLSecondsAfterFinished deletes the job once it finished.
+	TTLSecondsAfterFinished *int32
+	CommonBuilder
+}
+
+type BuilderCronJob struct {
+	CronJobSpec *batchv1.CronJobSpec
+	// TTLSecondsAfterFinished deletes the jobs spawned by the cronjob once they finished.
+	TTLSecondsAfterFinished *int32
+	CommonBuilder
+}
+
+func ToNewBuilderJob(builder []BuilderJob) func(*Builder) {
+	return func(s *Builder) {
+		s.Job = builder
+	}
+}
+
+func ToNewBuilderCronJob(builder []BuilderCronJob) func(*Builder) {
+	return func(s *Builder) {
+		s.CronJob = builder
+	}
+}
+
+// ReconcileJob creates the jobs whose spec has not run successfully yet and reports their progress
+// as a "Job.<name>" condition, a job in progress requeues the reconcile.
+func (s *Builder) ReconcileJob() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(job))
+
+	for _, j := range s.Job {
+
+		if j.JobSpec == nil {
+			continue
+		}
+
+		makeJob, hash, err := j.makeJob()
+		if err != nil {
+			result.add(string(job), j.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			continue
+		}
+
+		s.Put(makeJob.GetName(), makeJob.Kind)
+
+		conditionType := "Job." + j.ObjectMeta.Name
+
+		if j.hasSucceeded(hash) {
+			s.setCondition(conditionType, metav1.ConditionTrue, "Succeeded", fmt.Sprintf("Job [%s] succeeded", makeJob.GetName()))
+			continue
+		}
+
+		j.DesiredState = makeJob
+		current := &batchv1.Job{}
+		if err := j.Client.Get(s.Context.Context, *namespacedName(makeJob.GetName(), makeJob.GetNamespace()), current); err != nil {
+			if !apierrors.IsNotFound(err) {
+				result.add(makeJob.Kind, makeJob.GetName(), controllerutil.OperationResultNone, err)
+				continue
+			}
+
+			addOwnerRefToObject(makeJob, j.OwnerRef)
+			operation, err := j.Create(s.Context.Context, s.Recorder)
+			result.add(makeJob.Kind, makeJob.GetName(), operation, err)
+			if err == nil {
+				s.setCondition(conditionType, metav1.ConditionUnknown, "Running", fmt.Sprintf("Job [%s] is running", makeJob.GetName()))
+				result.rolloutInProgress()
+			}
+			continue
+		}
+
+		switch {
+		case isJobConditionTrue(current, batchv1.JobComplete):
+			if err := j.recordSucceeded(s.Context.Context, hash); err != nil {
+				result.add(makeJob.Kind, makeJob.GetName(), controllerutil.OperationResultNone, err)
+				continue
+			}
+			s.Recorder.jobEvent(j.CrObject, current, v1.EventTypeNormal, "succeeded")
+			s.setCondition(conditionType, metav1.ConditionTrue, "Succeeded", fmt.Sprintf("Job [%s] succeeded", makeJob.GetName()))
+		case isJobConditionTrue(current, batchv1.JobFailed):
+			// a failed job is not retried until its spec changes, its failure is evented once
+			if current.GetAnnotations()[jobFailureReportedAnnotation] == "" {
+				if err := j.recordFailureReported(s.Context.Context, current); err != nil {
+					result.add(makeJob.Kind, makeJob.GetName(), controllerutil.OperationResultNone, err)
+					continue
+				}
+				s.Recorder.jobEvent(j.CrObject, current, v1.EventTypeWarning, "failed")
+			}
+			s.setCondition(conditionType, metav1.ConditionFalse, "Failed", fmt.Sprintf("Job [%s] failed", makeJob.GetName()))
+		default:
+			s.setCondition(conditionType, metav1.ConditionUnknown, "Running", fmt.Sprintf("Job [%s] is running", makeJob.GetName()))
+			result.rolloutInProgress()
+		}
+	}
+
+	return result, result.Err()
+}
+
+// ReconcileCronJob reconciles the cronjobs and reports the outcome of their last scheduled run as a
+// "CronJob.<name>" condition.
+func (s *Builder) ReconcileCronJob() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(cronJob))
+
+	for _, cj := range s.CronJob {
+
+		if cj.CronJobSpec == nil {
+			continue
+		}
+
+		makeCronJob := cj.makeCronJob()
+
+		s.Put(makeCronJob.GetName(), makeCronJob.Kind)
+
+		cj.DesiredState = makeCronJob
+		cj.CurrentState = &batchv1.CronJob{}
+
+		operation, err := cj.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(makeCronJob.Kind, makeCronJob.GetName(), operation, err)
+		if err != nil {
+			continue
+		}
+
+		current, ok := cj.CurrentState.(*batchv1.CronJob)
+		if !ok || current.Status.LastScheduleTime == nil {
+			continue
+		}
+
+		conditionType := "CronJob." + cj.ObjectMeta.Name
+		lastSuccessful := current.Status.LastSuccessfulTime
+		switch {
+		case lastSuccessful != nil && !lastSuccessful.Before(current.Status.LastScheduleTime):
+			s.setCondition(conditionType, metav1.ConditionTrue, "Succeeded", fmt.Sprintf("CronJob [%s] last run succeeded", makeCronJob.GetName()))
+		case len(current.Status.Active) > 0:
+			s.setCondition(conditionType, metav1.ConditionUnknown, "Running", fmt.Sprintf("CronJob [%s] is running", makeCronJob.GetName()))
+		default:
+			s.setCondition(conditionType, metav1.ConditionFalse, "Failed", fmt.Sprintf("CronJob [%s] last run failed", makeCronJob.GetName()))
+		}
+	}
+
+	return result, result.Err()
+}
+
+// makeJob returns the job named after the hash of its spec, along with the hash.
+func (b *BuilderJob) makeJob() (*batchv1.Job, string, error) {
+
+	spec := *b.JobSpec.DeepCopy()
+	if b.TTLSecondsAfterFinished != nil {
+		spec.TTLSecondsAfterFinished = b.TTLSecondsAfterFinished
+	}
+
+	hash, err := specHash(spec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the base name is truncated so the hash suffix always fits
+	name := b.ObjectMeta.Name
+	if limit := maxJobNameLength - len(hash) - 1; len(name) > limit {
+		name = name[:limit]
+	}
+
+	objectMeta := *b.ObjectMeta.DeepCopy()
+	objectMeta.Name = name + "-" + hash
+
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "batch/v1",
+			Kind:       "Job",
+		},
+		ObjectMeta: objectMeta,
+		Spec:       spec,
+	}, hash, nil
+}
+
+func (b *BuilderCronJob) makeCronJob() *batchv1.CronJob {
+
+	spec := *b.CronJobSpec.DeepCopy()
+	if b.TTLSecondsAfterFinished != nil {
+		spec.JobTemplate.Spec.TTLSecondsAfterFinished = b.TTLSecondsAfterFinished
+	}
+
+	return &batchv1.CronJob{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "batch/v1",
+			Kind:       "CronJob",
+		},
+		ObjectMeta: b.ObjectMeta,
+		Spec:       spec,
+	}
+}
+
+func (b *BuilderJob) hasSucceeded(hash string) bool {
+	return b.CrObject.GetAnnotations()[jobSucceededAnnotationPrefix+b.ObjectMeta.Name] == hash
+}
+
+// recordSucceeded patches the custom resource with the spec hash of the successful run.
+func (b *BuilderJob) recordSucceeded(ctx context.Context, hash string) error {
+	return b.annotateCr(ctx, jobSucceededAnnotationPrefix+b.ObjectMeta.Name, hash)
+}
+
+// recordFailureReported marks the failed job as evented.
+func (b *BuilderJob) recordFailureReported(ctx context.Context, current *batchv1.Job) error {
+
+	patch := client.MergeFrom(current.DeepCopy())
+
+	annotations := make(map[string]string, len(current.GetAnnotations())+1)
+	for key, value := range current.GetAnnotations() {
+		annotations[key] = value
+	}
+	annotations[jobFailureReportedAnnotation] = "true"
+	current.SetAnnotations(annotations)
+
+	return b.Client.Patch(ctx, current, patch)
+}
+
+// areJobsSucceeded reports whether every job a node type waits for has succeeded with its current spec.
+func (s *Builder) areJobsSucceeded(node BuilderDeploymentStatefulSet) (bool, error) {
+
+	for _, name := range node.WaitForJobs {
+
+		var found bool
+		for _, j := range s.Job {
+			if j.ObjectMeta.Name != name || j.JobSpec == nil {
+				continue
+			}
+			found = true
+
+			_, hash, err := j.makeJob()
+			if err != nil {
+				return false, err
+			}
+			if !j.hasSucceeded(hash) {
+				return false, nil
+			}
+		}
+
+		if !found {
+			return false, fmt.Errorf("node type [%s] waits for unknown job [%s]", node.ObjectMeta.Name, name)
+		}
+	}
+
+	return true, nil
+}
+
+func isJobConditionTrue(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// specHash returns a hash of the spec which is valid as part of an object name.
+func specHash(spec interface{}) (string, error) {
+	bytes, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:])[:jobHashLength], nil
+}
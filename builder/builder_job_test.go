@@ -0,0 +1,264 @@
+package builder
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestJob(c client.Client, cr client.Object) BuilderJob {
+	return BuilderJob{
+		JobSpec: &batchv1.JobSpec{
+			Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "migrate", Image: "migrate:1"}}}},
+		},
+		CommonBuilder: newTestCommonBuilder(c, cr, "migrate"),
+	}
+}
+
+func TestReconcileJob(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		condition batchv1.JobConditionType
+		absent    bool
+		rollout   bool
+		succeeded bool
+		warnings  int
+		normals   int
+	}{
+		{
+			name:    "job created",
+			absent:  true,
+			rollout: true,
+			normals: 1,
+		},
+		{
+			name:    "job running",
+			rollout: true,
+		},
+		{
+			name:      "job complete",
+			condition: batchv1.JobComplete,
+			succeeded: true,
+			normals:   1,
+		},
+		{
+			name:      "job failed is evented once",
+			condition: batchv1.JobFailed,
+			warnings:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			cr := newTestCr()
+			j := newTestJob(nil, cr)
+			desired, hash, err := j.makeJob()
+			if err != nil {
+				t.Fatalf("makeJob() error = %v", err)
+			}
+
+			existing := []client.Object{cr.DeepCopy()}
+			if !tt.absent {
+				current := &batchv1.Job{ObjectMeta: newTestObjectMeta(cr, desired.GetName()), Spec: desired.Spec}
+				if tt.condition != "" {
+					current.Status.Conditions = []batchv1.JobCondition{{Type: tt.condition, Status: v1.ConditionTrue}}
+				}
+				existing = append(existing, current)
+			}
+
+			c := newTestClient(existing...)
+			recorder := newTestRecorder()
+			j = newTestJob(c, cr)
+			b := newTestBuilder(c, cr, recorder, ToNewBuilderJob([]BuilderJob{j}))
+
+			// a second reconcile must not event the outcome again
+			for i := 0; i < 2; i++ {
+				result, err := b.ReconcileJob()
+				if err != nil {
+					t.Fatalf("ReconcileJob() error = %v", err)
+				}
+				if result.RolloutInProgress != tt.rollout {
+					t.Errorf("RolloutInProgress = %v, want %v", result.RolloutInProgress, tt.rollout)
+				}
+			}
+
+			var warnings, normals int
+			for _, event := range recordedEvents(recorder.Recorder.(*record.FakeRecorder)) {
+				switch {
+				case strings.HasPrefix(event, v1.EventTypeWarning):
+					warnings++
+				case strings.HasPrefix(event, v1.EventTypeNormal):
+					normals++
+				}
+			}
+			if warnings != tt.warnings || normals != tt.normals {
+				t.Errorf("events = %d warnings and %d normal, want %d and %d", warnings, normals, tt.warnings, tt.normals)
+			}
+
+			if succeeded := cr.GetAnnotations()[jobSucceededAnnotationPrefix+"migrate"] == hash; succeeded != tt.succeeded {
+				t.Errorf("succeeded recorded = %v, want %v", succeeded, tt.succeeded)
+			}
+		})
+	}
+}
+
+func TestReconcileDeployOrStsWaitsForJobs(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		succeeded bool
+		updated   bool
+	}{
+		{
+			name: "job has not succeeded",
+		},
+		{
+			name:      "job succeeded",
+			succeeded: true,
+			updated:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			cr := newTestCr()
+			if tt.succeeded {
+				j := newTestJob(nil, cr)
+				_, hash, err := j.makeJob()
+				if err != nil {
+					t.Fatalf("makeJob() error = %v", err)
+				}
+				cr.SetAnnotations(map[string]string{jobSucceededAnnotationPrefix + "migrate": hash})
+			}
+
+			// the node type was rolled out with an earlier spec
+			c := newTestClient(cr.DeepCopy(), newTestDeployment(cr, "broker"))
+			node := newTestNode(c, cr, "broker", "Deployment")
+			node.WaitForJobs = []string{"migrate"}
+
+			b := newTestBuilder(c, cr, newTestRecorder(),
+				ToNewBuilderJob([]BuilderJob{newTestJob(c, cr)}),
+				ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{node}),
+			)
+
+			result, err := b.ReconcileDeployOrSts()
+			if err != nil {
+				t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+			}
+			if !result.RolloutInProgress {
+				t.Errorf("RolloutInProgress = false, want true")
+			}
+			if err := b.ReconcileStore(); err != nil {
+				t.Fatalf("ReconcileStore() error = %v", err)
+			}
+
+			live := newTestDeployment(cr, "broker")
+			if !exists(c, live) {
+				t.Fatalf("node type waiting for a job was collected")
+			}
+			if _, updated := live.GetAnnotations()[node.OwnerRef.Kind+"OperatorHash"]; updated != tt.updated {
+				t.Errorf("node type updated = %v, want %v", updated, tt.updated)
+			}
+		})
+	}
+}
+
+func TestReconcileStoreDeletePropagation(t *testing.T) {
+
+	cr := newTestCr()
+	background := metav1.DeletePropagationBackground
+
+	tests := []struct {
+		name        string
+		obj         client.Object
+		kind        K8sObjectName
+		propagation *metav1.DeletionPropagation
+	}{
+		{
+			name:        "jobs delete their pods",
+			obj:         &batchv1.Job{ObjectMeta: newTestObjectMeta(cr, "migrate-0123456789")},
+			kind:        job,
+			propagation: &background,
+		},
+		{
+			name: "other kinds use the api server default",
+			obj:  newTestDeployment(cr, "removed"),
+			kind: deployment,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c := &deleteRecordingClient{Client: newTestClient(cr.DeepCopy(), tt.obj)}
+			b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder())
+			b.manageKind(string(tt.kind))
+
+			if err := b.ReconcileStore(); err != nil {
+				t.Fatalf("ReconcileStore() error = %v", err)
+			}
+
+			opts, ok := c.deletes[tt.obj.GetName()]
+			if !ok {
+				t.Fatalf("[%s] was not collected", tt.obj.GetName())
+			}
+			if (opts.PropagationPolicy == nil) != (tt.propagation == nil) ||
+				(opts.PropagationPolicy != nil && *opts.PropagationPolicy != *tt.propagation) {
+				t.Errorf("propagation = %v, want %v", opts.PropagationPolicy, tt.propagation)
+			}
+		})
+	}
+}
+
+func TestMakeJobTruncatesLongNames(t *testing.T) {
+	cr := newTestCr()
+	j := newTestJob(newTestClient(), cr)
+	j.ObjectMeta.Name = strings.Repeat("a", 70)
+
+	job, hash, err := j.makeJob()
+	if err != nil {
+		t.Fatalf("makeJob() error = %v", err)
+	}
+	if len(job.GetName()) != maxJobNameLength {
+		t.Errorf("len(name) = %d, want %d", len(job.GetName()), maxJobNameLength)
+	}
+	if !strings.HasSuffix(job.GetName(), "-"+hash) {
+		t.Errorf("name = %s, want suffix -%s", job.GetName(), hash)
+	}
+}
+
+// recordedEvents drains the events recorded so far.
+func recordedEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// deleteRecordingClient records the options of every delete.
+type deleteRecordingClient struct {
+	client.Client
+	deletes map[string]*client.DeleteOptions
+}
+
+func (c *deleteRecordingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if c.deletes == nil {
+		c.deletes = make(map[string]*client.DeleteOptions)
+	}
+	c.deletes[obj.GetName()] = (&client.DeleteOptions{}).ApplyOptions(opts)
+	return c.Client.Delete(ctx, obj, opts...)
+}
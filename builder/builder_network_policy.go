@@ -3,8 +3,6 @@ package builder
 import (
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 type BuilderNetworkPolicy struct {
@@ -18,10 +16,11 @@ func ToNewBuilderNetworkPolicy(builder []BuilderNetworkPolicy) func(*Builder) {
 	}
 }
 
-func (s *Builder) ReconcileNetworkPolicy() (controllerutil.OperationResult, error) {
+func (s *Builder) ReconcileNetworkPolicy() (Result, error) {
+
+	var result Result
 
-	var err error
-	var result controllerutil.OperationResult
+	s.manageKind(string(networkPolicy))
 
 	for _, np := range s.NetworkPolicy {
 
@@ -29,16 +28,16 @@ func (s *Builder) ReconcileNetworkPolicy() (controllerutil.OperationResult, erro
 
 			makeNp := np.makeNetworkPolicy()
 
+			s.Put(makeNp.GetName(), makeNp.Kind)
+
 			np.DesiredState = makeNp
 			np.CurrentState = &networkingv1.NetworkPolicy{}
 
-			result, err = np.CreateOrUpdate(s.Context.Context, s.Recorder)
-			if err != nil {
-				return controllerutil.OperationResultNone, nil
-			}
+			operation, err := np.CreateOrUpdate(s.Context.Context, s.Recorder)
+			result.add(makeNp.Kind, makeNp.GetName(), operation, err)
 		}
 	}
-	return result, nil
+	return result, result.Err()
 }
 
 func (b *BuilderNetworkPolicy) makeNetworkPolicy() *networkingv1.NetworkPolicy {
@@ -0,0 +1,171 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Phase groups the objects reconciled together by ReconcileAll.
+type Phase string
+
+const (
+	// PhaseConfig reconciles ConfigMaps and Secrets.
+	PhaseConfig Phase = "Config"
+	// PhaseIdentity reconciles ServiceAccounts, Roles, ClusterRoles and their bindings.
+	PhaseIdentity Phase = "Identity"
+	// PhaseStorage reconciles PersistentVolumeClaims.
+	PhaseStorage Phase = "Storage"
+	// PhaseNetworking reconciles Services, NetworkPolicies, Ingresses and Gateway API routes.
+	PhaseNetworking Phase = "Networking"
+	// PhaseUnstructured reconciles the objects built by BuilderUnstructured.
+	PhaseUnstructured Phase = "Unstructured"
+	// PhaseJobs reconciles Jobs and CronJobs, node types waiting for a job are held back until
+	// it succeeded.
+	PhaseJobs Phase = "Jobs"
+	// PhaseWorkloads reconciles Deployments, StatefulSets, their PodDisruptionBudgets and
+	// HorizontalPodAutoscalers.
+	PhaseWorkloads Phase = "Workloads"
+	// PhaseGC garbage collects the objects which are not desired anymore.
+	PhaseGC Phase = "GarbageCollection"
+)
+
+// DefaultPhases is the order used by ReconcileAll when no phases are configured.
+var DefaultPhases = []Phase{
+	PhaseConfig,
+	PhaseIdentity,
+	PhaseStorage,
+	PhaseNetworking,
+	PhaseUnstructured,
+	PhaseJobs,
+	PhaseWorkloads,
+	PhaseGC,
+}
+
+// PhaseHook runs before or after a phase, an error stops ReconcileAll.
+type PhaseHook func(ctx context.Context, phase Phase) error
+
+type BuilderPhases struct {
+	// Phases are run in order, phases left out are skipped. Defaults to DefaultPhases.
+	Phases    []Phase
+	PreHooks  map[Phase][]PhaseHook
+	PostHooks map[Phase][]PhaseHook
+}
+
+func ToNewBuilderPhases(builder BuilderPhases) func(*Builder) {
+	return func(s *Builder) {
+		s.Phases = builder
+	}
+}
+
+// ReconcileAll runs every configured phase and aggregates their results. A failing phase does not
+// stop the following ones. Garbage collection skips the kinds managed by a phase which failed or
+// reported a rollout in progress, so objects are never deleted based on an incomplete phase.
+func (s *Builder) ReconcileAll() (Result, error) {
+
+	var result Result
+
+	phases := s.Phases.Phases
+	if len(phases) == 0 {
+		phases = DefaultPhases
+	}
+
+	held := make(map[string]bool)
+
+	for _, phase := range phases {
+
+		if err := s.runPhaseHooks(s.Phases.PreHooks[phase], phase); err != nil {
+			result.add(string(phase), "PreHook", controllerutil.OperationResultNone, err)
+			return result, result.Err()
+		}
+
+		s.Store.phaseKinds = make(map[string]bool)
+		phaseResult, err := s.reconcilePhase(phase, held)
+		if err != nil && len(phaseResult.Errors) == 0 {
+			phaseResult.add(string(phase), "", controllerutil.OperationResultNone, err)
+		}
+		if len(phaseResult.Errors) > 0 || phaseResult.RolloutInProgress {
+			for kind := range s.Store.phaseKinds {
+				held[kind] = true
+			}
+		}
+		s.Store.phaseKinds = nil
+		result.Merge(phaseResult)
+
+		if err := s.runPhaseHooks(s.Phases.PostHooks[phase], phase); err != nil {
+			result.add(string(phase), "PostHook", controllerutil.OperationResultNone, err)
+			return result, result.Err()
+		}
+	}
+
+	return result, result.Err()
+}
+
+// reconcilePhase reconciles the built-in kinds of a phase followed by its Resources, garbage
+// collection leaves the held kinds alone.
+func (s *Builder) reconcilePhase(phase Phase, held map[string]bool) (Result, error) {
+
+	result, err := s.reconcileBuiltinPhase(phase, held)
+	if err != nil && len(result.Errors) == 0 {
+		return result, err
+	}
+	result.Merge(s.reconcileResources(phase))
+
+	return result, result.Err()
+}
+
+func (s *Builder) reconcileBuiltinPhase(phase Phase, held map[string]bool) (Result, error) {
+	switch phase {
+	case PhaseConfig:
+		result, _ := s.ReconcileConfigMap()
+		secretResult, _ := s.ReconcileSecret()
+		result.Merge(secretResult)
+		return result, result.Err()
+	case PhaseIdentity:
+		result, _ := s.ReconcileServiceAccount()
+		roleResult, _ := s.ReconcileRole()
+		result.Merge(roleResult)
+		roleBindingResult, _ := s.ReconcileRoleBinding()
+		result.Merge(roleBindingResult)
+		return result, result.Err()
+	case PhaseStorage:
+		return s.ReconcileStorage()
+	case PhaseNetworking:
+		result, _ := s.ReconcileService()
+		networkPolicyResult, _ := s.ReconcileNetworkPolicy()
+		result.Merge(networkPolicyResult)
+		ingressResult, _ := s.ReconcileIngress()
+		result.Merge(ingressResult)
+		routeResult, _ := s.ReconcileRoute()
+		result.Merge(routeResult)
+		return result, result.Err()
+	case PhaseUnstructured:
+		return s.ReconcileUnstructured()
+	case PhaseJobs:
+		result, _ := s.ReconcileJob()
+		cronJobResult, _ := s.ReconcileCronJob()
+		result.Merge(cronJobResult)
+		return result, result.Err()
+	case PhaseWorkloads:
+		result, _ := s.ReconcileDeployOrSts()
+		pdbResult, _ := s.ReconcilePodDisruptionBudget()
+		result.Merge(pdbResult)
+		hpaResult, _ := s.ReconcileHPA()
+		result.Merge(hpaResult)
+		return result, result.Err()
+	case PhaseGC:
+		result := s.reconcileStoreExcept(held)
+		return result, result.Err()
+	}
+	return Result{}, fmt.Errorf("unknown phase [%s]", phase)
+}
+
+func (s *Builder) runPhaseHooks(hooks []PhaseHook, phase Phase) error {
+	for _, hook := range hooks {
+		if err := hook(s.Context.Context, phase); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileAllHoldsGarbageCollection(t *testing.T) {
+
+	cr := newTestCr()
+
+	tests := []struct {
+		name         string
+		existing     []client.Object
+		failures     map[string]error
+		nodes        []string
+		deployments  bool
+		configMaps   bool
+		wantErrCount int
+	}{
+		{
+			name:        "nothing in progress",
+			nodes:       []string{"first"},
+			deployments: true,
+			configMaps:  true,
+		},
+		{
+			name:       "rollout in progress holds workloads only",
+			existing:   []client.Object{newTestDeployment(cr, "first")},
+			nodes:      []string{"first", "second"},
+			configMaps: true,
+		},
+		{
+			name:         "failed phase holds its kinds only",
+			failures:     map[string]error{"config": errors.New("exceeded quota")},
+			nodes:        []string{"first"},
+			deployments:  true,
+			wantErrCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			removedDeployment := newTestDeployment(cr, "removed")
+			removedConfigMap := newTestConfigMap("removed", nil)
+			removedConfigMap.ObjectMeta = newTestObjectMeta(cr, "removed")
+
+			objs := append([]client.Object{cr.DeepCopy(), removedDeployment.DeepCopy(), removedConfigMap.DeepCopy()}, tt.existing...)
+			c := &failingCreateClient{Client: newTestClient(objs...), failures: tt.failures}
+
+			var nodes []BuilderDeploymentStatefulSet
+			for _, name := range tt.nodes {
+				nodes = append(nodes, newTestNode(c, cr, name, "Deployment"))
+			}
+
+			b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder(),
+				ToNewBuilderConfigMap([]BuilderConfigMap{{Data: map[string]string{"key": "value"}, CommonBuilder: newTestCommonBuilder(c, cr, "config")}}),
+				ToNewBuilderDeploymentStatefulSet(nodes),
+				ToNewBuilderPhases(BuilderPhases{Phases: []Phase{PhaseConfig, PhaseWorkloads, PhaseGC}}),
+			)
+
+			result, _ := b.ReconcileAll()
+			if len(result.Errors) != tt.wantErrCount {
+				t.Errorf("ReconcileAll() errors = %v, want %d", result.Errors, tt.wantErrCount)
+			}
+
+			if collected := !exists(c, removedDeployment); collected != tt.deployments {
+				t.Errorf("orphan deployment collected = %v, want %v", collected, tt.deployments)
+			}
+			if collected := !exists(c, removedConfigMap); collected != tt.configMaps {
+				t.Errorf("orphan config map collected = %v, want %v", collected, tt.configMaps)
+			}
+		})
+	}
+}
+
+func TestReconcileAllRunsHooks(t *testing.T) {
+
+	cr := newTestCr()
+	c := newTestClient(cr.DeepCopy())
+
+	var ran []string
+	hook := func(name string, err error) PhaseHook {
+		return func(ctx context.Context, phase Phase) error {
+			ran = append(ran, name+string(phase))
+			return err
+		}
+	}
+
+	b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder(), ToNewBuilderPhases(BuilderPhases{
+		Phases:    []Phase{PhaseConfig, PhaseStorage, PhaseGC},
+		PreHooks:  map[Phase][]PhaseHook{PhaseConfig: {hook("pre", nil)}},
+		PostHooks: map[Phase][]PhaseHook{PhaseStorage: {hook("post", errors.New("backup failed"))}},
+	}))
+
+	if _, err := b.ReconcileAll(); err == nil {
+		t.Error("ReconcileAll() error = nil, want the post hook error")
+	}
+	if len(ran) != 2 || ran[0] != "preConfig" || ran[1] != "postStorage" {
+		t.Errorf("hooks ran = %v, want [preConfig postStorage]", ran)
+	}
+}
@@ -0,0 +1,98 @@
+package builder
+
+import (
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type BuilderPodDisruptionBudget struct {
+	MinAvailable   *intstr.IntOrString
+	MaxUnavailable *intstr.IntOrString
+	SelectorLabels map[string]string
+	CommonBuilder
+}
+
+// PodDisruptionBudgetPolicy generates a pdb for a node type selecting its pods, when neither
+// field is set one pod may be unavailable at a time.
+type PodDisruptionBudgetPolicy struct {
+	MinAvailable   *intstr.IntOrString
+	MaxUnavailable *intstr.IntOrString
+}
+
+func ToNewBuilderPodDisruptionBudget(builder []BuilderPodDisruptionBudget) func(*Builder) {
+	return func(s *Builder) {
+		s.PodDisruptionBudget = builder
+	}
+}
+
+// ReconcilePodDisruptionBudget reconciles the declared pdbs and the pdbs generated for node types
+// with a PodDisruptionBudget policy.
+func (s *Builder) ReconcilePodDisruptionBudget() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(podDisruptionBudget))
+
+	pdbs := append([]BuilderPodDisruptionBudget{}, s.PodDisruptionBudget...)
+	for _, deployorsts := range s.DeploymentOrStatefulset {
+		if pdb, ok := deployorsts.podDisruptionBudget(); ok {
+			pdbs = append(pdbs, pdb)
+		}
+	}
+
+	for _, pdb := range pdbs {
+
+		makePdb := pdb.makePodDisruptionBudget()
+
+		s.Put(makePdb.GetName(), makePdb.Kind)
+
+		pdb.DesiredState = makePdb
+		pdb.CurrentState = &policyv1.PodDisruptionBudget{}
+
+		operation, err := pdb.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(makePdb.Kind, makePdb.GetName(), operation, err)
+	}
+
+	return result, result.Err()
+}
+
+func (b *BuilderPodDisruptionBudget) makePodDisruptionBudget() *policyv1.PodDisruptionBudget {
+	return &policyv1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "policy/v1",
+			Kind:       "PodDisruptionBudget",
+		},
+		ObjectMeta: b.ObjectMeta,
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable:   b.MinAvailable,
+			MaxUnavailable: b.MaxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: b.SelectorLabels,
+			},
+		},
+	}
+}
+
+// podDisruptionBudget derives the pdb of a node type from its labels and replicas. Node types with
+// a single replica get no pdb, as it would either block node drains or protect nothing.
+func (b *BuilderDeploymentStatefulSet) podDisruptionBudget() (BuilderPodDisruptionBudget, bool) {
+
+	if b.PodDisruptionBudget == nil || b.Replicas < 2 {
+		return BuilderPodDisruptionBudget{}, false
+	}
+
+	pdb := BuilderPodDisruptionBudget{
+		MinAvailable:   b.PodDisruptionBudget.MinAvailable,
+		MaxUnavailable: b.PodDisruptionBudget.MaxUnavailable,
+		SelectorLabels: b.Labels,
+		CommonBuilder:  b.derivedCommonBuilder(b.ObjectMeta.Name, b.ObjectMeta.Namespace),
+	}
+
+	if pdb.MinAvailable == nil && pdb.MaxUnavailable == nil {
+		maxUnavailable := intstr.FromInt(1)
+		pdb.MaxUnavailable = &maxUnavailable
+	}
+
+	return pdb, true
+}
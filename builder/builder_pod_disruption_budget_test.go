@@ -0,0 +1,81 @@
+package builder
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestReconcilePodDisruptionBudgetForNodeTypes(t *testing.T) {
+
+	cr := newTestCr()
+	minAvailable := intstr.FromString("50%")
+	maxUnavailable := intstr.FromInt(1)
+
+	tests := []struct {
+		name           string
+		replicas       int32
+		policy         *PodDisruptionBudgetPolicy
+		minAvailable   *intstr.IntOrString
+		maxUnavailable *intstr.IntOrString
+	}{
+		{
+			name:     "no policy",
+			replicas: 3,
+		},
+		{
+			name:     "single replica",
+			replicas: 1,
+			policy:   &PodDisruptionBudgetPolicy{},
+		},
+		{
+			name:           "one pod unavailable by default",
+			replicas:       3,
+			policy:         &PodDisruptionBudgetPolicy{},
+			maxUnavailable: &maxUnavailable,
+		},
+		{
+			name:         "min available",
+			replicas:     3,
+			policy:       &PodDisruptionBudgetPolicy{MinAvailable: &minAvailable},
+			minAvailable: &minAvailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c := newTestClient(cr.DeepCopy())
+			node := newTestNode(c, cr, "historical", "Statefulset")
+			node.Replicas = tt.replicas
+			node.PodDisruptionBudget = tt.policy
+
+			b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{node}))
+			if _, err := b.ReconcilePodDisruptionBudget(); err != nil {
+				t.Fatalf("ReconcilePodDisruptionBudget() error = %v", err)
+			}
+
+			pdb := &policyv1.PodDisruptionBudget{}
+			err := c.Get(context.Background(), objectKey("historical"), pdb)
+			if tt.minAvailable == nil && tt.maxUnavailable == nil {
+				if err == nil {
+					t.Error("pdb was created, want none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(pdb.Spec.MinAvailable, tt.minAvailable) || !reflect.DeepEqual(pdb.Spec.MaxUnavailable, tt.maxUnavailable) {
+				t.Errorf("pdb minAvailable = %v, maxUnavailable = %v, want %v and %v", pdb.Spec.MinAvailable, pdb.Spec.MaxUnavailable, tt.minAvailable, tt.maxUnavailable)
+			}
+			if !reflect.DeepEqual(pdb.Spec.Selector.MatchLabels, testLabels) {
+				t.Errorf("pdb selector = %v, want the node type labels %v", pdb.Spec.Selector.MatchLabels, testLabels)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package builder
+
+import (
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ownerUIDLabel marks cluster scoped objects with the uid of the custom resource, as they cannot
+// carry an owner reference to a namespaced object.
+const ownerUIDLabel = "operator-runtime.datainfra.io/owner-uid"
+
+type BuilderServiceAccount struct {
+	AutomountServiceAccountToken *bool
+	ImagePullSecrets             []v1.LocalObjectReference
+	CommonBuilder
+}
+
+type BuilderRole struct {
+	Rules []rbacv1.PolicyRule
+	// ClusterScoped builds a ClusterRole, ObjectMeta.Namespace must be empty.
+	ClusterScoped bool
+	CommonBuilder
+}
+
+type BuilderRoleBinding struct {
+	RoleRef  rbacv1.RoleRef
+	Subjects []rbacv1.Subject
+	// ClusterScoped builds a ClusterRoleBinding, ObjectMeta.Namespace must be empty.
+	ClusterScoped bool
+	CommonBuilder
+}
+
+// NodeIdentity generates a ServiceAccount for a node type and binds its pods to it. Rules are
+// granted in the namespace through a Role, ClusterRules cluster wide through a ClusterRole.
+type NodeIdentity struct {
+	AutomountServiceAccountToken *bool
+	Rules                        []rbacv1.PolicyRule
+	ClusterRules                 []rbacv1.PolicyRule
+}
+
+func ToNewBuilderServiceAccount(builder []BuilderServiceAccount) func(*Builder) {
+	return func(s *Builder) {
+		s.ServiceAccount = builder
+	}
+}
+
+func ToNewBuilderRole(builder []BuilderRole) func(*Builder) {
+	return func(s *Builder) {
+		s.Role = builder
+	}
+}
+
+func ToNewBuilderRoleBinding(builder []BuilderRoleBinding) func(*Builder) {
+	return func(s *Builder) {
+		s.RoleBinding = builder
+	}
+}
+
+func (s *Builder) ReconcileServiceAccount() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(serviceAccount))
+
+	serviceAccounts := append([]BuilderServiceAccount{}, s.ServiceAccount...)
+	for _, deployorsts := range s.DeploymentOrStatefulset {
+		if deployorsts.Identity != nil {
+			serviceAccounts = append(serviceAccounts, BuilderServiceAccount{
+				AutomountServiceAccountToken: deployorsts.Identity.AutomountServiceAccountToken,
+				CommonBuilder:                deployorsts.derivedCommonBuilder(deployorsts.ObjectMeta.Name, deployorsts.ObjectMeta.Namespace),
+			})
+		}
+	}
+
+	for _, sa := range serviceAccounts {
+
+		makeSa := sa.makeServiceAccount()
+
+		s.Put(makeSa.GetName(), makeSa.Kind)
+
+		sa.DesiredState = makeSa
+		sa.CurrentState = &v1.ServiceAccount{}
+
+		operation, err := sa.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(makeSa.Kind, makeSa.GetName(), operation, err)
+	}
+
+	return result, result.Err()
+}
+
+func (s *Builder) ReconcileRole() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(role))
+	s.manageKind(string(clusterRole))
+
+	roles := append([]BuilderRole{}, s.Role...)
+	for _, deployorsts := range s.DeploymentOrStatefulset {
+		if deployorsts.Identity == nil {
+			continue
+		}
+		if len(deployorsts.Identity.Rules) > 0 {
+			roles = append(roles, BuilderRole{
+				Rules:         deployorsts.Identity.Rules,
+				CommonBuilder: deployorsts.derivedCommonBuilder(deployorsts.ObjectMeta.Name, deployorsts.ObjectMeta.Namespace),
+			})
+		}
+		if len(deployorsts.Identity.ClusterRules) > 0 {
+			roles = append(roles, BuilderRole{
+				Rules:         deployorsts.Identity.ClusterRules,
+				ClusterScoped: true,
+				CommonBuilder: deployorsts.derivedCommonBuilder(deployorsts.clusterScopedName(), ""),
+			})
+		}
+	}
+
+	for _, r := range roles {
+
+		var makeRole client.Object
+		if r.ClusterScoped {
+			makeRole = &rbacv1.ClusterRole{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+				ObjectMeta: r.ObjectMeta,
+				Rules:      r.Rules,
+			}
+			r.CurrentState = &rbacv1.ClusterRole{}
+		} else {
+			makeRole = &rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+				ObjectMeta: r.ObjectMeta,
+				Rules:      r.Rules,
+			}
+			r.CurrentState = &rbacv1.Role{}
+		}
+
+		kind := makeRole.GetObjectKind().GroupVersionKind().Kind
+		s.Put(makeRole.GetName(), kind)
+
+		r.DesiredState = makeRole
+
+		operation, err := r.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(kind, makeRole.GetName(), operation, err)
+	}
+
+	return result, result.Err()
+}
+
+func (s *Builder) ReconcileRoleBinding() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(roleBinding))
+	s.manageKind(string(clusterRoleBinding))
+
+	bindings := append([]BuilderRoleBinding{}, s.RoleBinding...)
+	for _, deployorsts := range s.DeploymentOrStatefulset {
+		if deployorsts.Identity == nil {
+			continue
+		}
+		subjects := []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      deployorsts.ObjectMeta.Name,
+				Namespace: deployorsts.ObjectMeta.Namespace,
+			},
+		}
+		if len(deployorsts.Identity.Rules) > 0 {
+			bindings = append(bindings, BuilderRoleBinding{
+				RoleRef:       rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: deployorsts.ObjectMeta.Name},
+				Subjects:      subjects,
+				CommonBuilder: deployorsts.derivedCommonBuilder(deployorsts.ObjectMeta.Name, deployorsts.ObjectMeta.Namespace),
+			})
+		}
+		if len(deployorsts.Identity.ClusterRules) > 0 {
+			bindings = append(bindings, BuilderRoleBinding{
+				RoleRef:       rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: deployorsts.clusterScopedName()},
+				Subjects:      subjects,
+				ClusterScoped: true,
+				CommonBuilder: deployorsts.derivedCommonBuilder(deployorsts.clusterScopedName(), ""),
+			})
+		}
+	}
+
+	for _, rb := range bindings {
+
+		var makeBinding client.Object
+		if rb.ClusterScoped {
+			makeBinding = &rbacv1.ClusterRoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+				ObjectMeta: rb.ObjectMeta,
+				RoleRef:    rb.RoleRef,
+				Subjects:   rb.Subjects,
+			}
+			rb.CurrentState = &rbacv1.ClusterRoleBinding{}
+		} else {
+			makeBinding = &rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+				ObjectMeta: rb.ObjectMeta,
+				RoleRef:    rb.RoleRef,
+				Subjects:   rb.Subjects,
+			}
+			rb.CurrentState = &rbacv1.RoleBinding{}
+		}
+
+		kind := makeBinding.GetObjectKind().GroupVersionKind().Kind
+		s.Put(makeBinding.GetName(), kind)
+
+		rb.DesiredState = makeBinding
+
+		operation, err := rb.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(kind, makeBinding.GetName(), operation, err)
+	}
+
+	return result, result.Err()
+}
+
+func (b *BuilderServiceAccount) makeServiceAccount() *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ServiceAccount",
+		},
+		ObjectMeta:                   b.ObjectMeta,
+		AutomountServiceAccountToken: b.AutomountServiceAccountToken,
+		ImagePullSecrets:             b.ImagePullSecrets,
+	}
+}
+
+// FinalizeClusterScoped deletes the cluster scoped objects labelled with the uid of the custom resource.
+// They are not deleted along with the custom resource, so it is meant to be called from its finalizer.
+func (s *Builder) FinalizeClusterScoped() error {
+
+	var result Result
+
+	for _, list := range []client.ObjectList{&rbacv1.ClusterRoleList{}, &rbacv1.ClusterRoleBindingList{}} {
+		if err := s.Store.Client.List(s.Context.Context, list, client.MatchingLabels{ownerUIDLabel: string(s.Store.CrObject.GetUID())}); err != nil {
+			result.add(detectType(s.Store.CrObject, s.Store.Client.Scheme()), s.Store.CrObject.GetName(), controllerutil.OperationResultNone, err)
+			continue
+		}
+
+		switch list := list.(type) {
+		case *rbacv1.ClusterRoleList:
+			for i := range list.Items {
+				s.Store.CommonBuilder.DesiredState = &list.Items[i]
+				operation, err := s.Store.Delete(s.Context.Context, s.Recorder)
+				result.add(string(clusterRole), list.Items[i].GetName(), operation, err)
+			}
+		case *rbacv1.ClusterRoleBindingList:
+			for i := range list.Items {
+				s.Store.CommonBuilder.DesiredState = &list.Items[i]
+				operation, err := s.Store.Delete(s.Context.Context, s.Recorder)
+				result.add(string(clusterRoleBinding), list.Items[i].GetName(), operation, err)
+			}
+		}
+	}
+
+	return result.Err()
+}
+
+// clusterScopedName prefixes the name of cluster scoped objects with the namespace, so node types
+// of the same name in different namespaces do not collide.
+func (b *BuilderDeploymentStatefulSet) clusterScopedName() string {
+	return b.ObjectMeta.Namespace + "-" + b.ObjectMeta.Name
+}
+
+// markClusterScoped labels a cluster scoped object with the uid of its owner.
+func markClusterScoped(obj client.Object, ownerRef metav1.OwnerReference) {
+	labels := make(map[string]string, len(obj.GetLabels())+1)
+	for key, value := range obj.GetLabels() {
+		labels[key] = value
+	}
+	labels[ownerUIDLabel] = string(ownerRef.UID)
+	obj.SetLabels(labels)
+}
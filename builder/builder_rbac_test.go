@@ -0,0 +1,74 @@
+package builder
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileNodeIdentity(t *testing.T) {
+
+	cr := newTestCr()
+	c := newTestClient(cr.DeepCopy())
+
+	node := newTestNode(c, cr, "broker", "Deployment")
+	node.Identity = &NodeIdentity{
+		Rules:        []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}}},
+		ClusterRules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"list"}}},
+	}
+
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{node}))
+
+	for name, reconcile := range map[string]func() (Result, error){
+		"ReconcileServiceAccount": b.ReconcileServiceAccount,
+		"ReconcileRole":           b.ReconcileRole,
+		"ReconcileRoleBinding":    b.ReconcileRoleBinding,
+		"ReconcileDeployOrSts":    b.ReconcileDeployOrSts,
+	} {
+		if _, err := reconcile(); err != nil {
+			t.Fatalf("%s() error = %v", name, err)
+		}
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := c.Get(context.Background(), objectKey("broker"), deployment); err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Spec.Template.Spec.ServiceAccountName != "broker" {
+		t.Errorf("serviceAccountName = %q, want the node type identity", deployment.Spec.Template.Spec.ServiceAccountName)
+	}
+
+	for _, obj := range []client.Object{
+		&v1.ServiceAccount{},
+		&rbacv1.Role{},
+		&rbacv1.RoleBinding{},
+	} {
+		if err := c.Get(context.Background(), objectKey("broker"), obj); err != nil {
+			t.Errorf("%T was not created: %v", obj, err)
+		}
+	}
+
+	clusterRoleBinding := &rbacv1.ClusterRoleBinding{}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: "default-broker"}, clusterRoleBinding); err != nil {
+		t.Fatal(err)
+	}
+	if clusterRoleBinding.RoleRef.Name != "default-broker" || clusterRoleBinding.Subjects[0].Namespace != testNamespace {
+		t.Errorf("cluster role binding = %+v, want the namespaced service account bound to [default-broker]", clusterRoleBinding)
+	}
+	if len(clusterRoleBinding.OwnerReferences) != 0 || !b.isOwnedByCr(clusterRoleBinding) {
+		t.Error("cluster role binding is not owned through the owner uid label")
+	}
+
+	if err := b.FinalizeClusterScoped(); err != nil {
+		t.Fatalf("FinalizeClusterScoped() error = %v", err)
+	}
+	for _, obj := range []client.Object{&rbacv1.ClusterRole{}, &rbacv1.ClusterRoleBinding{}} {
+		if err := c.Get(context.Background(), client.ObjectKey{Name: "default-broker"}, obj); err == nil {
+			t.Errorf("%T was not finalized", obj)
+		}
+	}
+}
@@ -2,16 +2,22 @@ package builder
 
 import (
 	"fmt"
-	"reflect"
+	"strings"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 type BuilderRecorder struct {
 	Recorder       record.EventRecorder
 	ControllerName string
+
+	// scheme names the kinds of evented objects, NewBuilder sets it from the store client.
+	scheme *runtime.Scheme
 }
 
 func ToNewBuilderRecorder(builder BuilderRecorder) func(*Builder) {
@@ -34,13 +40,13 @@ func (b *BuilderRecorder) createEvent(crObj client.Object, obj client.Object, er
 		b.Recorder.Event(
 			crObj,
 			v1.EventTypeWarning,
-			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Err [%s]", obj.GetName(), obj.GetNamespace(), detectType(obj), err.Error()),
+			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Err [%s]", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), err.Error()),
 			b.ControllerName+"CreateObjectFail")
 	} else {
 		b.Recorder.Event(
 			crObj,
 			v1.EventTypeNormal,
-			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s]", obj.GetName(), obj.GetNamespace(), detectType(obj)),
+			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s]", obj.GetName(), obj.GetNamespace(), b.kindOf(obj)),
 			b.ControllerName+"CreateObjectSuccess")
 	}
 }
@@ -50,13 +56,13 @@ func (b *BuilderRecorder) updateEvent(crObj client.Object, obj client.Object, er
 		b.Recorder.Event(
 			crObj,
 			v1.EventTypeWarning,
-			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Err [%s]", obj.GetName(), obj.GetNamespace(), detectType(obj), err.Error()),
+			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Err [%s]", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), err.Error()),
 			b.ControllerName+"UpdateObjectFail")
 	} else {
 		b.Recorder.Event(
 			crObj,
 			v1.EventTypeNormal,
-			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s]", obj.GetName(), obj.GetNamespace(), detectType(obj)),
+			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s]", obj.GetName(), obj.GetNamespace(), b.kindOf(obj)),
 			b.ControllerName+"UpdateObjectSuccess")
 	}
 }
@@ -66,7 +72,7 @@ func (b *BuilderRecorder) getEvent(crObj client.Object, obj client.Object, err e
 		b.Recorder.Event(
 			crObj,
 			v1.EventTypeWarning,
-			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Error [%s]", obj.GetName(), obj.GetNamespace(), detectType(obj), err.Error()),
+			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Error [%s]", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), err.Error()),
 			b.ControllerName+"GetObjectFail")
 	}
 }
@@ -76,7 +82,7 @@ func (b *BuilderRecorder) listEvent(crObj client.Object, obj client.Object, err
 		b.Recorder.Event(
 			crObj,
 			v1.EventTypeWarning,
-			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Error [%s]", obj.GetName(), obj.GetNamespace(), detectType(obj), err.Error()),
+			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Error [%s]", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), err.Error()),
 			b.ControllerName+"ListObjectFail")
 	}
 }
@@ -86,15 +92,102 @@ func (b *BuilderRecorder) deleteEvent(crObj client.Object, obj client.Object, er
 		b.Recorder.Event(
 			crObj,
 			v1.EventTypeWarning,
-			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Error [%s]", obj.GetName(), obj.GetNamespace(), detectType(obj), err.Error()),
+			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Error [%s]", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), err.Error()),
 			b.ControllerName+"DeleteObjectFail")
 	} else {
 		b.Recorder.Event(
 			crObj,
 			v1.EventTypeNormal,
-			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s]", obj.GetName(), obj.GetNamespace(), detectType(obj)),
+			fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s]", obj.GetName(), obj.GetNamespace(), b.kindOf(obj)),
 			b.ControllerName+"DeleteObjectSuccess")
 	}
 }
 
-func detectType(obj client.Object) string { return reflect.TypeOf(obj).String() }
+func (b *BuilderRecorder) driftEvent(crObj client.Object, obj client.Object) {
+	b.Recorder.Event(
+		crObj,
+		v1.EventTypeWarning,
+		fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], live object drifted from desired state", obj.GetName(), obj.GetNamespace(), b.kindOf(obj)),
+		b.ControllerName+"Drift")
+}
+
+func (b *BuilderRecorder) volumeExpansionEvent(crObj client.Object, obj client.Object, msg string) {
+	b.Recorder.Event(
+		crObj,
+		v1.EventTypeNormal,
+		fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], %s", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), msg),
+		b.ControllerName+"VolumeExpansion")
+}
+
+func (b *BuilderRecorder) recreateEvent(crObj client.Object, obj client.Object, fields []string) {
+	b.Recorder.Event(
+		crObj,
+		v1.EventTypeNormal,
+		fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], immutable fields [%s] changed, object is recreated", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), strings.Join(fields, ", ")),
+		b.ControllerName+"RecreateObject")
+}
+
+func (b *BuilderRecorder) rotateEvent(crObj client.Object, obj client.Object) {
+	b.Recorder.Event(
+		crObj,
+		v1.EventTypeNormal,
+		fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], generated values rotated", obj.GetName(), obj.GetNamespace(), b.kindOf(obj)),
+		b.ControllerName+"RotateObjectSuccess")
+}
+
+func (b *BuilderRecorder) jobEvent(crObj client.Object, obj client.Object, eventType, outcome string) {
+	b.Recorder.Event(
+		crObj,
+		eventType,
+		fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], job %s", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), outcome),
+		b.ControllerName+"JobFinished")
+}
+
+func (b *BuilderRecorder) canaryEvent(crObj client.Object, obj client.Object, eventType, msg string) {
+	b.Recorder.Event(
+		crObj,
+		eventType,
+		fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], canary %s", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), msg),
+		b.ControllerName+"Canary")
+}
+
+func (b *BuilderRecorder) scaleDownEvent(crObj client.Object, obj client.Object, eventType, msg string) {
+	b.Recorder.Event(
+		crObj,
+		eventType,
+		fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], %s", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), msg),
+		b.ControllerName+"ScaleDown")
+}
+
+func (b *BuilderRecorder) rolloutEvent(crObj client.Object, obj client.Object, eventType, msg, reason string) {
+	b.Recorder.Event(
+		crObj,
+		eventType,
+		fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], %s", obj.GetName(), obj.GetNamespace(), b.kindOf(obj), msg),
+		b.ControllerName+reason)
+}
+
+func (b *BuilderRecorder) kindOf(obj client.Object) string { return detectType(obj, b.scheme) }
+
+// detectType returns the kind of an object, from its type meta when set or from the scheme of the
+// client which reads it. The client-go scheme is used when no scheme is given.
+func detectType(obj client.Object, objScheme *runtime.Scheme) string {
+	if kind := obj.GetObjectKind().GroupVersionKind().Kind; kind != "" {
+		return kind
+	}
+	if objScheme == nil {
+		objScheme = scheme.Scheme
+	}
+	if gvk, err := apiutil.GVKForObject(obj, objScheme); err == nil {
+		return gvk.Kind
+	}
+	return fmt.Sprintf("%T", obj)
+}
+
+// schemeOf returns the scheme of a client, nil when there is no client.
+func schemeOf(c client.Client) *runtime.Scheme {
+	if c == nil {
+		return nil
+	}
+	return c.Scheme()
+}
@@ -0,0 +1,227 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ResourceKind describes a kind to the runtime, it is registered with RegisterResourceKind.
+type ResourceKind interface {
+	// Kind names the kind in the store, results and events.
+	Kind() string
+	// NewList returns the list type used to garbage collect objects of the kind.
+	NewList() client.ObjectList
+	// IsReady reports whether a live object of the kind is ready, the reconcile is requeued
+	// until it is.
+	IsReady(obj client.Object) (bool, error)
+	// Phase is the ReconcileAll phase the kind is reconciled in.
+	Phase() Phase
+	// Order sorts the kinds of a phase, lower orders are reconciled first.
+	Order() int
+}
+
+// Resource builds a single object of a kind which is not built into the runtime. The object
+// is hashed, owned by the custom resource, evented and garbage collected the same way as the
+// built-in kinds. ResourceBuilder implements it for a concrete type.
+type Resource interface {
+	ResourceKind
+	// MakeDesired returns the desired state of the object, it is called before Kind.
+	MakeDesired() (client.Object, error)
+	// Common returns the builder settings of the object, embedding CommonBuilder provides it.
+	Common() *CommonBuilder
+}
+
+// KindDescriptor is a ResourceKind assembled from its parts. It describes the built-in kinds and
+// can be embedded by resources which need no behaviour of their own.
+type KindDescriptor struct {
+	Name string
+	List func() client.ObjectList
+	// Ready defaults to ready as soon as the object is written.
+	Ready          func(obj client.Object) (bool, error)
+	ReconcilePhase Phase
+	ReconcileOrder int
+}
+
+func (k KindDescriptor) Kind() string { return k.Name }
+
+func (k KindDescriptor) NewList() client.ObjectList { return k.List() }
+
+func (k KindDescriptor) IsReady(obj client.Object) (bool, error) {
+	if k.Ready == nil {
+		return true, nil
+	}
+	return k.Ready(obj)
+}
+
+func (k KindDescriptor) Phase() Phase { return k.ReconcilePhase }
+
+func (k KindDescriptor) Order() int { return k.ReconcileOrder }
+
+// Common lets builders embedding CommonBuilder implement Resource.
+func (b *CommonBuilder) Common() *CommonBuilder { return b }
+
+// resourceKinds holds every kind known to the runtime, the built-in ones and the ones registered
+// by operators.
+var resourceKinds = map[string]ResourceKind{}
+
+// pluggedKinds holds the kinds registered with RegisterResourceKind, they are always managed by
+// ReconcileResources so their orphans are collected.
+var pluggedKinds = map[string]bool{}
+
+func init() {
+	for _, kind := range []KindDescriptor{
+		{Name: string(configMap), ReconcilePhase: PhaseConfig, List: func() client.ObjectList { return &corev1.ConfigMapList{} }},
+		{Name: string(secret), ReconcilePhase: PhaseConfig, List: func() client.ObjectList { return &corev1.SecretList{} }},
+		{Name: string(serviceAccount), ReconcilePhase: PhaseIdentity, List: func() client.ObjectList { return &corev1.ServiceAccountList{} }},
+		{Name: string(role), ReconcilePhase: PhaseIdentity, List: func() client.ObjectList { return &rbacv1.RoleList{} }},
+		{Name: string(roleBinding), ReconcilePhase: PhaseIdentity, List: func() client.ObjectList { return &rbacv1.RoleBindingList{} }},
+		{Name: string(clusterRole), ReconcilePhase: PhaseIdentity, List: func() client.ObjectList { return &rbacv1.ClusterRoleList{} }},
+		{Name: string(clusterRoleBinding), ReconcilePhase: PhaseIdentity, List: func() client.ObjectList { return &rbacv1.ClusterRoleBindingList{} }},
+		{Name: string(pvc), ReconcilePhase: PhaseStorage, List: func() client.ObjectList { return &corev1.PersistentVolumeClaimList{} }},
+		{Name: string(svc), ReconcilePhase: PhaseNetworking, List: func() client.ObjectList { return &corev1.ServiceList{} }},
+		{Name: string(networkPolicy), ReconcilePhase: PhaseNetworking, List: func() client.ObjectList { return &networkingv1.NetworkPolicyList{} }},
+		{Name: string(ingress), ReconcilePhase: PhaseNetworking, List: func() client.ObjectList { return &networkingv1.IngressList{} }},
+		{Name: HTTPRouteKind, ReconcilePhase: PhaseNetworking, List: newRouteList(HTTPRouteKind)},
+		{Name: GRPCRouteKind, ReconcilePhase: PhaseNetworking, List: newRouteList(GRPCRouteKind)},
+		{Name: string(job), ReconcilePhase: PhaseJobs, List: func() client.ObjectList { return &batchv1.JobList{} }},
+		{Name: string(cronJob), ReconcilePhase: PhaseJobs, List: func() client.ObjectList { return &batchv1.CronJobList{} }},
+		{Name: string(deployment), ReconcilePhase: PhaseWorkloads, Ready: isWorkloadReady, List: func() client.ObjectList { return &appsv1.DeploymentList{} }},
+		{Name: string(statefulSet), ReconcilePhase: PhaseWorkloads, Ready: isWorkloadReady, List: func() client.ObjectList { return &appsv1.StatefulSetList{} }},
+		{Name: string(daemonSet), ReconcilePhase: PhaseWorkloads, Ready: isWorkloadReady, List: func() client.ObjectList { return &appsv1.DaemonSetList{} }},
+		{Name: string(podDisruptionBudget), ReconcilePhase: PhaseWorkloads, List: func() client.ObjectList { return &policyv1.PodDisruptionBudgetList{} }},
+		{Name: string(hpa), ReconcilePhase: PhaseWorkloads, List: func() client.ObjectList { return &autoscalingv2.HorizontalPodAutoscalerList{} }},
+	} {
+		resourceKinds[kind.Name] = kind
+	}
+}
+
+// RegisterResourceKind registers a kind reconciled by Resources, its objects which are no
+// longer desired are garbage collected by ReconcileStore. It is meant to be called during
+// initialisation, before any reconcile runs. It panics when the kind has no name, e.g. a
+// ResourceBuilder whose type is not known to the scheme.
+func RegisterResourceKind(kind ResourceKind) {
+	if kind.Kind() == "" {
+		panic(fmt.Sprintf("resource kind [%T] has no name", kind))
+	}
+	resourceKinds[kind.Kind()] = kind
+	pluggedKinds[kind.Kind()] = true
+}
+
+// RegisterStoreKind registers the list type of a kind, so objects of that kind which are
+// no longer desired are garbage collected by ReconcileStore. It is meant to be called
+// during initialisation, before any reconcile runs.
+func RegisterStoreKind(kind string, newList func() client.ObjectList) {
+	resourceKinds[kind] = KindDescriptor{Name: kind, List: newList}
+}
+
+func ToNewBuilderResources(builder []Resource) func(*Builder) {
+	return func(s *Builder) {
+		s.Resources = builder
+	}
+}
+
+// ReconcileResources reconciles the objects built by Resources, phase by phase in the
+// order of DefaultPhases.
+func (s *Builder) ReconcileResources() (Result, error) {
+
+	var result Result
+
+	for _, phase := range DefaultPhases {
+		result.Merge(s.reconcileResources(phase))
+	}
+
+	return result, result.Err()
+}
+
+func (s *Builder) reconcileResources(phase Phase) Result {
+
+	var result Result
+
+	for kind := range pluggedKinds {
+		if resourceKinds[kind].Phase() == phase {
+			s.manageKind(kind)
+		}
+	}
+
+	resources := make([]Resource, 0, len(s.Resources))
+	for _, resource := range s.Resources {
+		if resource.Phase() == phase {
+			resources = append(resources, resource)
+		}
+	}
+	sort.SliceStable(resources, func(i, j int) bool { return resources[i].Order() < resources[j].Order() })
+
+	for _, resource := range resources {
+
+		common := resource.Common()
+
+		desired, err := resource.MakeDesired()
+		if err != nil {
+			result.add(resource.Kind(), common.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			continue
+		}
+		kind := resource.Kind()
+
+		s.registerKind(kind, resource.NewList)
+		s.Put(desired.GetName(), kind)
+
+		common.DesiredState = desired
+		common.CurrentState = newObjectLike(desired)
+
+		operation, err := common.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(kind, desired.GetName(), operation, err)
+		if err != nil {
+			continue
+		}
+		// the live object predates the write, its readiness is checked on the next reconcile
+		if operation != controllerutil.OperationResultNone {
+			result.rolloutInProgress()
+			continue
+		}
+
+		ready, err := resource.IsReady(common.CurrentState)
+		if err != nil {
+			result.add(kind, desired.GetName(), controllerutil.OperationResultNone, err)
+			continue
+		}
+		if !ready {
+			result.rolloutInProgress()
+		}
+	}
+
+	return result
+}
+
+// newObjectLike returns an empty object of the same type as obj to read the live state into.
+func newObjectLike(obj client.Object) client.Object {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(u.GroupVersionKind())
+		return current
+	}
+	return reflect.New(reflect.TypeOf(obj).Elem()).Interface().(client.Object)
+}
+
+// newStoreList returns the list type of a managed kind, kinds registered by the store take
+// precedence over the registry.
+func (s *Builder) newStoreList(kind string) (client.ObjectList, bool) {
+	if newList, ok := s.Store.Kinds[kind]; ok {
+		return newList(), true
+	}
+	if resourceKind, ok := resourceKinds[kind]; ok {
+		return resourceKind.NewList(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,101 @@
+package builder
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// endpointsKind is registered once for the tests, the registry is global.
+var endpointsKind = KindDescriptor{
+	Name:           "Endpoints",
+	List:           func() client.ObjectList { return &v1.EndpointsList{} },
+	ReconcilePhase: PhaseNetworking,
+}
+
+func init() {
+	RegisterResourceKind(endpointsKind)
+}
+
+type endpointsBuilder struct {
+	KindDescriptor
+	CommonBuilder
+}
+
+func (b *endpointsBuilder) MakeDesired() (client.Object, error) {
+	return &v1.Endpoints{ObjectMeta: b.ObjectMeta}, nil
+}
+
+func newTestEndpointsBuilder(c client.Client, cr client.Object, name string) *endpointsBuilder {
+	return &endpointsBuilder{KindDescriptor: endpointsKind, CommonBuilder: newTestCommonBuilder(c, cr, name)}
+}
+
+func TestReconcileResources(t *testing.T) {
+	cr := newTestCr()
+	orphan := &v1.Endpoints{ObjectMeta: newTestObjectMeta(cr, "old-endpoints")}
+	c := newTestClient(orphan)
+
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderResources([]Resource{
+		newTestEndpointsBuilder(c, cr, "endpoints"),
+	}))
+
+	result, err := b.ReconcileResources()
+	if err != nil {
+		t.Fatalf("ReconcileResources() error = %v", err)
+	}
+	// the object was just written, its readiness is checked on the next reconcile
+	if !result.RolloutInProgress {
+		t.Errorf("RolloutInProgress = false, want true after a create")
+	}
+	if err := b.ReconcileStore(); err != nil {
+		t.Fatalf("ReconcileStore() error = %v", err)
+	}
+
+	if !exists(c, &v1.Endpoints{ObjectMeta: newTestObjectMeta(cr, "endpoints")}) {
+		t.Errorf("endpoints was not created or was garbage collected")
+	}
+	if exists(c, orphan) {
+		t.Errorf("orphaned endpoints old-endpoints was not garbage collected")
+	}
+}
+
+func TestReconcileResourcesCollectsPluggedKindsWithoutBuilders(t *testing.T) {
+	cr := newTestCr()
+	orphan := &v1.Endpoints{ObjectMeta: newTestObjectMeta(cr, "old-endpoints")}
+	c := newTestClient(orphan)
+
+	b := newTestBuilder(c, cr, newTestRecorder())
+
+	if _, err := b.ReconcileResources(); err != nil {
+		t.Fatalf("ReconcileResources() error = %v", err)
+	}
+	if err := b.ReconcileStore(); err != nil {
+		t.Fatalf("ReconcileStore() error = %v", err)
+	}
+
+	if exists(c, orphan) {
+		t.Errorf("orphaned endpoints old-endpoints was not garbage collected")
+	}
+}
+
+func TestReconcileResourcesWaitsForReadiness(t *testing.T) {
+	cr := newTestCr()
+	c := newTestClient()
+
+	notReady := newTestEndpointsBuilder(c, cr, "endpoints")
+	notReady.Ready = func(obj client.Object) (bool, error) {
+		return len(obj.(*v1.Endpoints).Subsets) > 0, nil
+	}
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderResources([]Resource{notReady}))
+
+	for i := 0; i < 2; i++ {
+		result, err := b.ReconcileResources()
+		if err != nil {
+			t.Fatalf("ReconcileResources() error = %v", err)
+		}
+		if !result.RolloutInProgress {
+			t.Errorf("reconcile %d: RolloutInProgress = false, want true while not ready", i)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// defaultRequeueAfter is suggested while a rollout is in progress.
+const defaultRequeueAfter = 10 * time.Second
+
+// ObjectResult is the outcome of reconciling a single object.
+type ObjectResult struct {
+	Kind      string
+	Name      string
+	Operation controllerutil.OperationResult
+	Err       error
+}
+
+// ObjectError identifies the object which failed to reconcile.
+type ObjectError struct {
+	Kind string
+	Name string
+	Err  error
+}
+
+func (e *ObjectError) Error() string {
+	return fmt.Sprintf("Kind [%s], Name [%s], Err [%s]", e.Kind, e.Name, e.Err.Error())
+}
+
+func (e *ObjectError) Unwrap() error { return e.Err }
+
+// ReconcileError collects every failure of a reconcile, the builder keeps reconciling the
+// remaining objects when one of them fails.
+type ReconcileError struct {
+	Errors []error
+}
+
+func (e *ReconcileError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%d errors occurred: [%s]", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the collected errors, errors.Is and errors.As follow them from Go 1.20.
+func (e *ReconcileError) Unwrap() []error { return e.Errors }
+
+// Is lets errors.Is match any of the collected errors, also before Go 1.20.
+func (e *ReconcileError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As lets errors.As match any of the collected errors, also before Go 1.20.
+func (e *ReconcileError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Result is the outcome of a reconcile, it is returned by every Reconcile method of the builder.
+type Result struct {
+	Objects []ObjectResult
+	// RolloutInProgress is set when a workload rollout has not completed, the reconcile
+	// stopped before every node type was rolled out.
+	RolloutInProgress bool
+	// RequeueAfter is the suggested delay before the next reconcile, zero means no requeue.
+	RequeueAfter time.Duration
+	// Errors holds an ObjectError for every object which failed to reconcile.
+	Errors []error
+}
+
+func (r *Result) add(kind, name string, operation controllerutil.OperationResult, err error) {
+	r.Objects = append(r.Objects, ObjectResult{
+		Kind:      kind,
+		Name:      name,
+		Operation: operation,
+		Err:       err,
+	})
+	if err != nil {
+		r.Errors = append(r.Errors, &ObjectError{Kind: kind, Name: name, Err: err})
+	}
+}
+
+func (r *Result) rolloutInProgress() {
+	r.RolloutInProgress = true
+	r.requeueAfter(defaultRequeueAfter)
+}
+
+// requeueAfter keeps the shortest suggested delay.
+func (r *Result) requeueAfter(after time.Duration) {
+	if after > 0 && (r.RequeueAfter == 0 || after < r.RequeueAfter) {
+		r.RequeueAfter = after
+	}
+}
+
+// Merge adds the outcome of another reconcile to the result.
+func (r *Result) Merge(other Result) {
+	r.Objects = append(r.Objects, other.Objects...)
+	r.Errors = append(r.Errors, other.Errors...)
+	r.RolloutInProgress = r.RolloutInProgress || other.RolloutInProgress
+	r.requeueAfter(other.RequeueAfter)
+}
+
+// Operation summarises the result as a single OperationResult, created wins over updated.
+func (r Result) Operation() controllerutil.OperationResult {
+	operation := controllerutil.OperationResultNone
+	for _, object := range r.Objects {
+		switch object.Operation {
+		case controllerutil.OperationResultCreated:
+			return controllerutil.OperationResultCreated
+		case controllerutil.OperationResultUpdated:
+			operation = controllerutil.OperationResultUpdated
+		}
+	}
+	return operation
+}
+
+// Err returns the errors of the result as a ReconcileError, or nil when there are none.
+func (r Result) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return &ReconcileError{Errors: r.Errors}
+}
+
+// CtrlResult adapts the result to the return values of a controller-runtime Reconcile, errors are
+// returned so the controller requeues with backoff, otherwise the suggested delay is used.
+func (r Result) CtrlResult() (reconcile.Result, error) {
+	if err := r.Err(); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: r.RequeueAfter}, nil
+}
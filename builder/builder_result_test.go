@@ -0,0 +1,113 @@
+package builder
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestResultOperation(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		operations []controllerutil.OperationResult
+		want       controllerutil.OperationResult
+	}{
+		{name: "empty", want: controllerutil.OperationResultNone},
+		{
+			name:       "updated",
+			operations: []controllerutil.OperationResult{controllerutil.OperationResultNone, controllerutil.OperationResultUpdated},
+			want:       controllerutil.OperationResultUpdated,
+		},
+		{
+			name:       "created wins",
+			operations: []controllerutil.OperationResult{controllerutil.OperationResultUpdated, controllerutil.OperationResultCreated},
+			want:       controllerutil.OperationResultCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result Result
+			for _, operation := range tt.operations {
+				result.add("ConfigMap", "config", operation, nil)
+			}
+			if got := result.Operation(); got != tt.want {
+				t.Errorf("Operation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResultMerge(t *testing.T) {
+
+	var result Result
+	result.add("ConfigMap", "config", controllerutil.OperationResultCreated, nil)
+	result.requeueAfter(time.Minute)
+
+	var rollout Result
+	rollout.add("Deployment", "broker", controllerutil.OperationResultNone, errors.New("broker failed"))
+	rollout.rolloutInProgress()
+
+	result.Merge(rollout)
+
+	if len(result.Objects) != 2 || len(result.Errors) != 1 {
+		t.Errorf("Merge() kept %d objects and %d errors, want 2 and 1", len(result.Objects), len(result.Errors))
+	}
+	if !result.RolloutInProgress {
+		t.Error("RolloutInProgress = false, want true")
+	}
+	if result.RequeueAfter != defaultRequeueAfter {
+		t.Errorf("RequeueAfter = %s, want the shortest delay %s", result.RequeueAfter, defaultRequeueAfter)
+	}
+
+	ctrlResult, err := result.CtrlResult()
+	if err == nil || ctrlResult.RequeueAfter != 0 {
+		t.Errorf("CtrlResult() = %v, %v, want the error without a delay", ctrlResult, err)
+	}
+
+	result.Errors = nil
+	if ctrlResult, err := result.CtrlResult(); err != nil || ctrlResult.RequeueAfter != defaultRequeueAfter {
+		t.Errorf("CtrlResult() = %v, %v, want a requeue after %s", ctrlResult, err, defaultRequeueAfter)
+	}
+}
+
+func TestReconcileErrorMatchesCollectedErrors(t *testing.T) {
+
+	immutable := &ImmutableFieldError{Kind: "*v1.StatefulSet", Name: "historical", Err: errors.New("invalid")}
+	result := Result{}
+	result.add("ConfigMap", "config", controllerutil.OperationResultNone, errSentinel)
+	result.add("StatefulSet", "historical", controllerutil.OperationResultNone, immutable)
+
+	err := result.Err()
+	reconcileErr, ok := err.(*ReconcileError)
+	if !ok {
+		t.Fatalf("Err() = %T, want *ReconcileError", err)
+	}
+
+	// the methods are called directly as well, errors.Is and errors.As only follow
+	// Unwrap() []error from Go 1.20
+	if !reconcileErr.Is(errSentinel) || !errors.Is(err, errSentinel) {
+		t.Error("errors.Is() = false for a collected error")
+	}
+	if reconcileErr.Is(errors.New("other")) {
+		t.Error("Is() = true for an error which was not collected")
+	}
+
+	var objectErr *ObjectError
+	if !reconcileErr.As(&objectErr) || objectErr.Name != "config" {
+		t.Errorf("As() = %v, want the first object error", objectErr)
+	}
+
+	var immutableErr *ImmutableFieldError
+	if !reconcileErr.As(&immutableErr) || immutableErr != immutable {
+		t.Errorf("As() = %v, want the wrapped immutable field error", immutableErr)
+	}
+	if !IsImmutableFieldError(err) {
+		t.Error("IsImmutableFieldError() = false for a reconcile error collecting one")
+	}
+}
+
+var errSentinel = errors.New("sentinel")
@@ -0,0 +1,182 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The rollout history of a deployment is kept in a configmap named after it.
+const (
+	rolloutHistorySuffix           = "-rollout-history"
+	rolloutKnownGoodTemplateKey    = "knownGoodTemplate"
+	rolloutRolledBackGenerationKey = "rolledBackGeneration"
+
+	rolloutCondition = "Rollout"
+)
+
+// RolloutFailedError is returned when a deployment reports a replica failure or exceeded its
+// progress deadline.
+type RolloutFailedError struct {
+	Name    string
+	Reason  string
+	Message string
+}
+
+func (e *RolloutFailedError) Error() string {
+	return fmt.Sprintf("rollout of [%s] failed, Reason [%s], Message [%s]", e.Name, e.Reason, e.Message)
+}
+
+// IsRolloutFailedError reports whether err, or any error it wraps, is a RolloutFailedError.
+func IsRolloutFailedError(err error) bool {
+	var rolloutErr *RolloutFailedError
+	return errors.As(err, &rolloutErr)
+}
+
+// deploymentRolloutFailure returns a RolloutFailedError when the deployment rollout failed.
+func deploymentRolloutFailure(deploy *appsv1.Deployment) error {
+	for _, condition := range deploy.Status.Conditions {
+		switch {
+		case condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == v1.ConditionTrue,
+			condition.Type == appsv1.DeploymentProgressing && condition.Status == v1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded":
+			return &RolloutFailedError{Name: deploy.GetName(), Reason: condition.Reason, Message: condition.Message}
+		}
+	}
+	return nil
+}
+
+// checkRollout reports whether the rollout of a node type completed and its health gates passed.
+// For deployments with RollbackOnFailure a failed rollout, or one whose health gates timed out, is
+// rolled back to the last known-good pod template and the node type is halted, so the following
+// node types are not rolled out until the custom resource changes. A completed rollout records
+// its pod template as known-good.
+func (s *Builder) checkRollout(node BuilderDeploymentStatefulSet) (bool, bool, error) {
+
+	done, failure := node.isObjFullyDeployed(s.Context.Context, s.Recorder)
+	if done {
+		done, failure = s.checkHealthGates(node)
+	}
+	if node.Kind != "Deployment" || !node.RollbackOnFailure {
+		return done, false, failure
+	}
+
+	history, err := s.rolloutHistory(node)
+	if err != nil {
+		return false, false, err
+	}
+
+	conditionType := rolloutCondition + "." + node.ObjectMeta.Name
+
+	if isRolledBack(node, history) {
+		return false, true, nil
+	}
+
+	if IsRolloutFailedError(failure) || IsHealthGateTimeoutError(failure) {
+		s.Recorder.rolloutEvent(node.CrObject, node.CurrentState, v1.EventTypeWarning, failure.Error(), "RolloutFailed")
+
+		if history.Data[rolloutKnownGoodTemplateKey] == "" {
+			s.setCondition(conditionType, metav1.ConditionFalse, "RolloutFailed", failure.Error())
+			return false, false, failure
+		}
+
+		history.Data[rolloutRolledBackGenerationKey] = strconv.FormatInt(node.CrObject.GetGeneration(), 10)
+		if err := s.writeRolloutHistory(node, history); err != nil {
+			return false, false, err
+		}
+
+		if _, err := s.buildDeployment(node); err != nil {
+			return false, false, err
+		}
+
+		s.Recorder.rolloutEvent(node.CrObject, node.CurrentState, v1.EventTypeNormal, "rolled back to the last known-good pod template", "RolledBack")
+		s.setCondition(conditionType, metav1.ConditionFalse, "RolledBack", failure.Error())
+		return false, true, nil
+	} else if failure != nil {
+		return false, false, failure
+	}
+
+	if done {
+		current, ok := node.CurrentState.(*appsv1.Deployment)
+		if !ok {
+			return done, false, nil
+		}
+		template, err := json.Marshal(current.Spec.Template)
+		if err != nil {
+			return false, false, err
+		}
+		if history.Data[rolloutKnownGoodTemplateKey] != string(template) {
+			history.Data[rolloutKnownGoodTemplateKey] = string(template)
+			if err := s.writeRolloutHistory(node, history); err != nil {
+				return false, false, err
+			}
+		}
+		s.setCondition(conditionType, metav1.ConditionTrue, "Complete", fmt.Sprintf("Deployment [%s] rolled out", node.ObjectMeta.Name))
+	}
+
+	return done, false, nil
+}
+
+// restoreKnownGoodTemplate replaces the pod template of a deployment which has been rolled back
+// during the current generation of the custom resource with the last known-good one.
+func (s *Builder) restoreKnownGoodTemplate(node BuilderDeploymentStatefulSet, desired *appsv1.Deployment) error {
+
+	history, err := s.rolloutHistory(node)
+	if err != nil {
+		return err
+	}
+	if !isRolledBack(node, history) {
+		return nil
+	}
+
+	template := v1.PodTemplateSpec{}
+	if err := json.Unmarshal([]byte(history.Data[rolloutKnownGoodTemplateKey]), &template); err != nil {
+		return err
+	}
+	desired.Spec.Template = template
+
+	s.setCondition(rolloutCondition+"."+node.ObjectMeta.Name, metav1.ConditionFalse, "RolledBack",
+		fmt.Sprintf("Deployment [%s] runs the last known-good pod template until the custom resource changes", node.ObjectMeta.Name))
+	return nil
+}
+
+// isRolledBack reports whether the node type was rolled back during the current generation.
+func isRolledBack(node BuilderDeploymentStatefulSet, history *v1.ConfigMap) bool {
+	return history.Data[rolloutRolledBackGenerationKey] == strconv.FormatInt(node.CrObject.GetGeneration(), 10) &&
+		history.Data[rolloutKnownGoodTemplateKey] != ""
+}
+
+// rolloutHistory returns the history configmap of a node type, an empty one when it does not exist.
+func (s *Builder) rolloutHistory(node BuilderDeploymentStatefulSet) (*v1.ConfigMap, error) {
+
+	history := &v1.ConfigMap{}
+	if err := node.Client.Get(s.Context.Context, *namespacedName(node.ObjectMeta.Name+rolloutHistorySuffix, node.ObjectMeta.Namespace), history); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		history = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      node.ObjectMeta.Name + rolloutHistorySuffix,
+				Namespace: node.ObjectMeta.Namespace,
+				Labels:    node.ObjectMeta.Labels,
+			},
+		}
+		addOwnerRefToObject(history, node.OwnerRef)
+	}
+	if history.Data == nil {
+		history.Data = make(map[string]string)
+	}
+	return history, nil
+}
+
+func (s *Builder) writeRolloutHistory(node BuilderDeploymentStatefulSet, history *v1.ConfigMap) error {
+	if history.GetResourceVersion() == "" {
+		return node.Client.Create(s.Context.Context, history)
+	}
+	return node.Client.Update(s.Context.Context, history)
+}
@@ -0,0 +1,154 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestCheckRolloutRollback(t *testing.T) {
+
+	cr := newTestCr()
+
+	knownGood, err := json.Marshal(v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: testLabels},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "app:0"}}},
+	})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	history := &v1.ConfigMap{
+		ObjectMeta: newTestObjectMeta(cr, "broker"+rolloutHistorySuffix),
+		Data:       map[string]string{rolloutKnownGoodTemplateKey: string(knownGood)},
+	}
+
+	failed := appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentProgressing, Status: v1.ConditionFalse, Reason: "ProgressDeadlineExceeded"},
+	}}
+	complete := appsv1.DeploymentStatus{Replicas: 1, ReadyReplicas: 1, Conditions: []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentProgressing, Status: v1.ConditionTrue},
+	}}
+
+	tests := []struct {
+		name     string
+		existing []client.Object
+		status   appsv1.DeploymentStatus
+		wantErr  bool
+		image    string
+		// knownGood is the image recorded as known-good, empty when none is
+		knownGood string
+		halted    bool
+	}{
+		{
+			name:      "completed rollout is recorded as known-good",
+			status:    complete,
+			image:     "app:1",
+			knownGood: "app:1",
+		},
+		{
+			name:    "failed rollout without a known-good template",
+			status:  failed,
+			wantErr: true,
+			image:   "app:1",
+		},
+		{
+			name:      "failed rollout is rolled back",
+			existing:  []client.Object{history},
+			status:    failed,
+			image:     "app:0",
+			knownGood: "app:0",
+			halted:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctx := context.Background()
+			c := newTestClient(append([]client.Object{cr.DeepCopy(), newTestDeployment(cr, "query")}, tt.existing...)...)
+
+			reconcile := func() (*Builder, Result, error) {
+				broker := newTestNode(c, cr, "broker", "Deployment")
+				broker.RollbackOnFailure = true
+				b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder(), ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{
+					broker,
+					newTestNode(c, cr, "query", "Deployment"),
+				}))
+				result, err := b.ReconcileDeployOrSts()
+				return b, result, err
+			}
+
+			// the deployment is created, then its rollout completes or fails
+			if _, _, err := reconcile(); err != nil {
+				t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+			}
+			live := &appsv1.Deployment{}
+			if err := c.Get(ctx, client.ObjectKey{Name: "broker", Namespace: testNamespace}, live); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			live.Status = tt.status
+			if err := c.Update(ctx, live); err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+
+			if _, _, err := reconcile(); (err != nil) != tt.wantErr {
+				t.Fatalf("ReconcileDeployOrSts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// a rolled back node type stays halted on the next reconcile, garbage collection keeps
+			// its history and the node types after it
+			b, result, err := reconcile()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReconcileDeployOrSts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				// ReconcileAll manages configmaps in its config phase
+				b.manageKind(string(configMap))
+				if err := b.ReconcileStore(); err != nil {
+					t.Fatalf("ReconcileStore() error = %v", err)
+				}
+			}
+			if tt.halted && result.RolloutInProgress {
+				t.Errorf("RolloutInProgress = true, want a halted rollout")
+			}
+
+			if err := c.Get(ctx, client.ObjectKeyFromObject(live), live); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if image := live.Spec.Template.Spec.Containers[0].Image; image != tt.image {
+				t.Errorf("image = %s, want %s", image, tt.image)
+			}
+
+			recorded := &v1.ConfigMap{}
+			err = c.Get(ctx, client.ObjectKeyFromObject(history), recorded)
+			if tt.knownGood == "" {
+				if err == nil && recorded.Data[rolloutKnownGoodTemplateKey] != "" {
+					t.Errorf("known-good template recorded for a failed rollout")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("rollout history is missing, %v", err)
+				}
+				template := v1.PodTemplateSpec{}
+				if err := json.Unmarshal([]byte(recorded.Data[rolloutKnownGoodTemplateKey]), &template); err != nil {
+					t.Fatalf("Unmarshal() error = %v", err)
+				}
+				if image := template.Spec.Containers[0].Image; image != tt.knownGood {
+					t.Errorf("known-good image = %s, want %s", image, tt.knownGood)
+				}
+				if _, rolledBack := recorded.Data[rolloutRolledBackGenerationKey]; rolledBack != tt.halted {
+					t.Errorf("rolled back = %v, want %v", rolledBack, tt.halted)
+				}
+			}
+
+			if !exists(c, newTestDeployment(cr, "query")) {
+				t.Errorf("node type after [broker] was collected")
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// hasRolloutDependencies reports whether any node type declares DependsOn, node types are
+// otherwise rolled out one after the other in slice order.
+func hasRolloutDependencies(nodes []BuilderDeploymentStatefulSet) bool {
+	for _, node := range nodes {
+		if len(node.DependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloutOrder returns the indexes of the node types sorted topologically by DependsOn, node types
+// without a dependency between them keep their slice order. Unknown dependencies and cycles are errors.
+func rolloutOrder(nodes []BuilderDeploymentStatefulSet) ([]int, error) {
+
+	index := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		index[node.ObjectMeta.Name] = i
+	}
+
+	inDegree := make([]int, len(nodes))
+	dependents := make([][]int, len(nodes))
+	for i, node := range nodes {
+		for _, dependency := range node.DependsOn {
+			j, ok := index[dependency]
+			if !ok {
+				return nil, fmt.Errorf("node type [%s] depends on unknown node type [%s]", node.ObjectMeta.Name, dependency)
+			}
+			inDegree[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	order := make([]int, 0, len(nodes))
+	visited := make([]bool, len(nodes))
+	for len(order) < len(nodes) {
+		next := -1
+		for i := range nodes {
+			if !visited[i] && inDegree[i] == 0 {
+				next = i
+				break
+			}
+		}
+
+		if next == -1 {
+			var cycle []string
+			for i, node := range nodes {
+				if !visited[i] {
+					cycle = append(cycle, node.ObjectMeta.Name)
+				}
+			}
+			return nil, fmt.Errorf("node types [%s] have cyclic dependencies", strings.Join(cycle, ", "))
+		}
+
+		visited[next] = true
+		order = append(order, next)
+		for _, dependent := range dependents[next] {
+			inDegree[dependent]--
+		}
+	}
+
+	return order, nil
+}
+
+// reconcileRolloutGraph walks the node types in rollout order, a node type is only reconciled once
+// every node type it depends on is fully deployed. Node types which do not depend on each other are
+// rolled out in the same reconcile, a failed node type only blocks its dependents.
+func (s *Builder) reconcileRolloutGraph(order []int) (Result, error) {
+
+	var result Result
+	healthy := make(map[string]bool, len(order))
+
+	for _, i := range order {
+		node := s.DeploymentOrStatefulset[i]
+
+		if !arePredecessorsHealthy(node, healthy) {
+			result.rolloutInProgress()
+			continue
+		}
+
+		succeeded, err := s.areJobsSucceeded(node)
+		if err != nil {
+			result.add(workloadKind(node), node.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			continue
+		}
+		if !succeeded {
+			result.rolloutInProgress()
+			continue
+		}
+
+		operation, err := s.buildWorkload(node)
+		result.add(workloadKind(node), node.ObjectMeta.Name, operation, err)
+		if err != nil {
+			continue
+		}
+		// dependents wait for the rollout of this node type to complete
+		if operation != controllerutil.OperationResultNone {
+			result.rolloutInProgress()
+			continue
+		}
+
+		switch node.Kind {
+		case "Deployment":
+			node.CurrentState = &appsv1.Deployment{}
+		case "Statefulset":
+			node.CurrentState = &appsv1.StatefulSet{}
+		case "DaemonSet":
+			node.CurrentState = &appsv1.DaemonSet{}
+		}
+
+		done, halted, err := s.checkRollout(node)
+		if err != nil {
+			result.add(workloadKind(node), node.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			continue
+		}
+		// dependents of a rolled back node type wait for the custom resource to change
+		if halted {
+			continue
+		}
+		if !done {
+			result.rolloutInProgress()
+		}
+		healthy[node.ObjectMeta.Name] = done
+	}
+
+	return result, result.Err()
+}
+
+func arePredecessorsHealthy(node BuilderDeploymentStatefulSet, healthy map[string]bool) bool {
+	for _, dependency := range node.DependsOn {
+		if !healthy[dependency] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Builder) buildWorkload(node BuilderDeploymentStatefulSet) (controllerutil.OperationResult, error) {
+	switch node.Kind {
+	case "Deployment":
+		return s.buildDeployment(node)
+	case "Statefulset":
+		return s.buildStatefulset(node)
+	case "DaemonSet":
+		return s.buildDaemonSet(node)
+	}
+	return controllerutil.OperationResultNone, unknownKindError(node)
+}
@@ -0,0 +1,128 @@
+package builder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRolloutOrder(t *testing.T) {
+
+	node := func(name string, dependsOn ...string) BuilderDeploymentStatefulSet {
+		n := BuilderDeploymentStatefulSet{DependsOn: dependsOn}
+		n.ObjectMeta.Name = name
+		return n
+	}
+
+	tests := []struct {
+		name    string
+		nodes   []BuilderDeploymentStatefulSet
+		order   []int
+		wantErr string
+	}{
+		{
+			name:  "slice order without dependencies between them",
+			nodes: []BuilderDeploymentStatefulSet{node("historical"), node("broker")},
+			order: []int{0, 1},
+		},
+		{
+			name:  "dependencies first",
+			nodes: []BuilderDeploymentStatefulSet{node("router", "broker"), node("broker", "historical"), node("historical")},
+			order: []int{2, 1, 0},
+		},
+		{
+			name:    "unknown dependency",
+			nodes:   []BuilderDeploymentStatefulSet{node("router", "broker")},
+			wantErr: "unknown node type [broker]",
+		},
+		{
+			name:    "cycle",
+			nodes:   []BuilderDeploymentStatefulSet{node("historical"), node("router", "broker"), node("broker", "router")},
+			wantErr: "[router, broker] have cyclic dependencies",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := rolloutOrder(tt.nodes)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("rolloutOrder() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rolloutOrder() error = %v", err)
+			}
+			if !reflect.DeepEqual(order, tt.order) {
+				t.Errorf("rolloutOrder() = %v, want %v", order, tt.order)
+			}
+		})
+	}
+}
+
+func TestReconcileRolloutGraphKeepsWaitingNodeTypes(t *testing.T) {
+
+	cr := newTestCr()
+
+	tests := []struct {
+		name     string
+		existing []client.Object
+		present  []string
+		absent   []string
+	}{
+		{
+			name:    "dependents are not created before their dependency",
+			present: []string{"broker", "independent"},
+			absent:  []string{"router", "query"},
+		},
+		{
+			name:     "dependents are kept while their dependency is updated",
+			existing: []client.Object{newTestDeployment(cr, "broker"), newTestDeployment(cr, "router"), newTestDeployment(cr, "query")},
+			present:  []string{"broker", "router", "query", "independent"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c := newTestClient(append([]client.Object{cr.DeepCopy()}, tt.existing...)...)
+
+			router := newTestNode(c, cr, "router", "Deployment")
+			router.DependsOn = []string{"broker"}
+			query := newTestNode(c, cr, "query", "Deployment")
+			query.DependsOn = []string{"router"}
+
+			b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder(), ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{
+				query,
+				router,
+				newTestNode(c, cr, "broker", "Deployment"),
+				newTestNode(c, cr, "independent", "Deployment"),
+			}))
+
+			result, err := b.ReconcileDeployOrSts()
+			if err != nil {
+				t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+			}
+			if !result.RolloutInProgress {
+				t.Errorf("RolloutInProgress = false, want true")
+			}
+			if err := b.ReconcileStore(); err != nil {
+				t.Fatalf("ReconcileStore() error = %v", err)
+			}
+
+			for _, name := range tt.present {
+				if !exists(c, newTestDeployment(cr, name)) {
+					t.Errorf("node type [%s] is missing", name)
+				}
+			}
+			for _, name := range tt.absent {
+				if exists(c, newTestDeployment(cr, name)) {
+					t.Errorf("node type [%s] was created before its dependency was deployed", name)
+				}
+			}
+		})
+	}
+}
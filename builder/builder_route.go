@@ -0,0 +1,216 @@
+package builder
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const gatewayAPIGroup = "gateway.networking.k8s.io"
+
+// Gateway API route kinds, routes are managed as unstructured objects so the runtime does not
+// depend on the Gateway API module.
+const (
+	HTTPRouteKind = "HTTPRoute"
+	GRPCRouteKind = "GRPCRoute"
+)
+
+var routeVersions = map[string]string{
+	HTTPRouteKind: "v1beta1",
+	GRPCRouteKind: "v1alpha2",
+}
+
+type BuilderRoute struct {
+	// Kind is HTTPRoute or GRPCRoute, defaults to HTTPRoute.
+	Kind string
+	// Version of the Gateway API, defaults to v1beta1 for HTTPRoute and v1alpha2 for GRPCRoute.
+	Version string
+	// Spec is the raw route spec, values set by ParentRefs, Hostnames and Backend take precedence.
+	Spec       map[string]interface{}
+	ParentRefs []RouteParentRef
+	Hostnames  []string
+	// Backend appends a rule routing to a service built by BuilderService.
+	Backend *ServiceBackend
+	CommonBuilder
+}
+
+// RouteParentRef references the Gateway a route attaches to.
+type RouteParentRef struct {
+	Name        string
+	Namespace   string
+	SectionName string
+}
+
+func ToNewBuilderRoute(builder []BuilderRoute) func(*Builder) {
+	return func(s *Builder) {
+		s.Route = builder
+	}
+}
+
+func (s *Builder) ReconcileRoute() (Result, error) {
+
+	var result Result
+
+	for _, kind := range []string{HTTPRouteKind, GRPCRouteKind} {
+		version, err := s.routeVersion(kind)
+		if err != nil {
+			result.add(kind, "", controllerutil.OperationResultNone, err)
+			continue
+		}
+		s.registerKind(kind, newUnstructuredList(schema.GroupVersionKind{Group: gatewayAPIGroup, Version: version, Kind: kind}))
+	}
+
+	for _, route := range s.Route {
+
+		makeRoute, err := route.makeRoute()
+		if err != nil {
+			result.add(route.kind(), route.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			continue
+		}
+
+		s.Put(makeRoute.GetName(), makeRoute.GetKind())
+
+		route.DesiredState = makeRoute
+		currentState := &unstructured.Unstructured{}
+		currentState.SetGroupVersionKind(makeRoute.GroupVersionKind())
+		route.CurrentState = currentState
+
+		operation, err := route.CreateOrUpdate(s.Context.Context, s.Recorder)
+		if meta.IsNoMatchError(err) {
+			s.Recorder.GenericEvent(
+				route.CrObject,
+				v1.EventTypeWarning,
+				fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], Gateway API is not installed", makeRoute.GetName(), makeRoute.GetNamespace(), makeRoute.GetKind()),
+				s.Recorder.ControllerName+"SkipObject",
+			)
+			continue
+		}
+		result.add(makeRoute.GetKind(), makeRoute.GetName(), operation, err)
+	}
+
+	return result, result.Err()
+}
+
+// routeVersion returns the version routes of a kind are garbage collected with, the version set on
+// the routes of that kind or else the version preferred by the cluster.
+func (s *Builder) routeVersion(kind string) (string, error) {
+
+	for _, route := range s.Route {
+		if route.kind() == kind && route.Version != "" {
+			return route.Version, nil
+		}
+	}
+
+	if s.Store.Client == nil {
+		return routeVersions[kind], nil
+	}
+
+	mapping, err := s.Store.Client.RESTMapper().RESTMapping(schema.GroupKind{Group: gatewayAPIGroup, Kind: kind})
+	if meta.IsNoMatchError(err) {
+		// the Gateway API is not installed, there is nothing to collect
+		return routeVersions[kind], nil
+	} else if err != nil {
+		return "", err
+	}
+	return mapping.GroupVersionKind.Version, nil
+}
+
+func (b *BuilderRoute) kind() string {
+	if b.Kind == "" {
+		return HTTPRouteKind
+	}
+	return b.Kind
+}
+
+func (b *BuilderRoute) makeRoute() (*unstructured.Unstructured, error) {
+
+	version := b.Version
+	if version == "" {
+		version = routeVersions[b.kind()]
+	}
+	if version == "" {
+		return nil, fmt.Errorf("unsupported route kind [%s]", b.kind())
+	}
+
+	spec := runtime.DeepCopyJSON(b.Spec)
+	if spec == nil {
+		spec = make(map[string]interface{})
+	}
+
+	if len(b.ParentRefs) > 0 {
+		parentRefs := make([]interface{}, 0, len(b.ParentRefs))
+		for _, parentRef := range b.ParentRefs {
+			ref := map[string]interface{}{"name": parentRef.Name}
+			if parentRef.Namespace != "" {
+				ref["namespace"] = parentRef.Namespace
+			}
+			if parentRef.SectionName != "" {
+				ref["sectionName"] = parentRef.SectionName
+			}
+			parentRefs = append(parentRefs, ref)
+		}
+		spec["parentRefs"] = parentRefs
+	}
+
+	if len(b.Hostnames) > 0 {
+		hostnames := make([]interface{}, 0, len(b.Hostnames))
+		for _, hostname := range b.Hostnames {
+			hostnames = append(hostnames, hostname)
+		}
+		spec["hostnames"] = hostnames
+	}
+
+	if b.Backend != nil {
+		serviceName, port, err := b.Backend.servicePort()
+		if err != nil {
+			return nil, err
+		}
+
+		rule := map[string]interface{}{
+			"backendRefs": []interface{}{
+				map[string]interface{}{
+					"name": serviceName,
+					"port": int64(port),
+				},
+			},
+		}
+		if b.kind() == HTTPRouteKind {
+			rule["matches"] = []interface{}{
+				map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":  "PathPrefix",
+						"value": b.Backend.path(),
+					},
+				},
+			}
+		}
+
+		rules, _, _ := unstructured.NestedSlice(spec, "rules")
+		spec["rules"] = append(rules, rule)
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	route.SetGroupVersionKind(schema.GroupVersionKind{Group: gatewayAPIGroup, Version: version, Kind: b.kind()})
+	objectMeta := b.ObjectMeta.DeepCopy()
+	route.SetName(objectMeta.Name)
+	route.SetNamespace(objectMeta.Namespace)
+	route.SetLabels(objectMeta.Labels)
+	route.SetAnnotations(objectMeta.Annotations)
+
+	return route, nil
+}
+
+// newRouteList returns the list type used to garbage collect routes of a kind.
+func newRouteList(kind string) func() client.ObjectList {
+	return func() client.ObjectList {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(schema.GroupVersionKind{Group: gatewayAPIGroup, Version: routeVersions[kind], Kind: kind + "List"})
+		return list
+	}
+}
@@ -0,0 +1,147 @@
+package builder
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestServiceBackend(portName string) *ServiceBackend {
+	service := &BuilderService{
+		ServiceSpec: &v1.ServiceSpec{Ports: []v1.ServicePort{
+			{Name: "metrics", Port: 9090},
+			{Name: "http", Port: 8082},
+		}},
+	}
+	service.ObjectMeta.Name = "broker"
+	return &ServiceBackend{Service: service, PortName: portName, Host: "druid.example.com", Path: "/druid"}
+}
+
+func TestReconcileIngressRoutesToServiceBackend(t *testing.T) {
+
+	cr := newTestCr()
+	c := newTestClient(cr.DeepCopy())
+
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderIngress([]BuilderIngress{{
+		Backend:       newTestServiceBackend("http"),
+		CommonBuilder: newTestCommonBuilder(c, cr, "broker"),
+	}}))
+
+	if _, err := b.ReconcileIngress(); err != nil {
+		t.Fatalf("ReconcileIngress() error = %v", err)
+	}
+
+	live := &networkingv1.Ingress{}
+	if err := c.Get(context.Background(), objectKey("broker"), live); err != nil {
+		t.Fatal(err)
+	}
+	if len(live.Spec.Rules) != 1 || live.Spec.Rules[0].Host != "druid.example.com" {
+		t.Fatalf("ingress rules = %v, want a rule for the backend host", live.Spec.Rules)
+	}
+	path := live.Spec.Rules[0].HTTP.Paths[0]
+	if path.Path != "/druid" || path.Backend.Service.Name != "broker" || path.Backend.Service.Port.Number != 8082 {
+		t.Errorf("ingress path = %+v, want /druid to broker:8082", path)
+	}
+}
+
+func TestMakeRoute(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		route       BuilderRoute
+		apiVersion  string
+		matches     bool
+		wantErr     bool
+		backendPort int64
+	}{
+		{
+			name:        "http route",
+			route:       BuilderRoute{Backend: newTestServiceBackend("")},
+			apiVersion:  gatewayAPIGroup + "/v1beta1",
+			matches:     true,
+			backendPort: 9090,
+		},
+		{
+			name:        "grpc route",
+			route:       BuilderRoute{Kind: GRPCRouteKind, Backend: newTestServiceBackend("http")},
+			apiVersion:  gatewayAPIGroup + "/v1alpha2",
+			backendPort: 8082,
+		},
+		{
+			name:    "unknown port",
+			route:   BuilderRoute{Backend: newTestServiceBackend("admin")},
+			wantErr: true,
+		},
+		{
+			name:    "unknown kind",
+			route:   BuilderRoute{Kind: "TCPRoute"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			tt.route.ParentRefs = []RouteParentRef{{Name: "gateway", SectionName: "https"}}
+			tt.route.Hostnames = []string{"druid.example.com"}
+			tt.route.ObjectMeta.Name = "broker"
+
+			route, err := tt.route.makeRoute()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("makeRoute() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("makeRoute() error = %v", err)
+			}
+
+			if route.GetAPIVersion() != tt.apiVersion {
+				t.Errorf("apiVersion = %s, want %s", route.GetAPIVersion(), tt.apiVersion)
+			}
+
+			parentRefs, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+			if want := []interface{}{map[string]interface{}{"name": "gateway", "sectionName": "https"}}; !reflect.DeepEqual(parentRefs, want) {
+				t.Errorf("parentRefs = %v, want %v", parentRefs, want)
+			}
+
+			rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+			if len(rules) != 1 {
+				t.Fatalf("rules = %v, want one backend rule", rules)
+			}
+			rule := rules[0].(map[string]interface{})
+			if _, ok := rule["matches"]; ok != tt.matches {
+				t.Errorf("rule matches set = %v, want %v", ok, tt.matches)
+			}
+			backend := rule["backendRefs"].([]interface{})[0].(map[string]interface{})
+			if backend["name"] != "broker" || backend["port"] != tt.backendPort {
+				t.Errorf("backendRef = %v, want broker:%d", backend, tt.backendPort)
+			}
+		})
+	}
+}
+
+func TestRouteVersion(t *testing.T) {
+
+	cr := newTestCr()
+	c := newTestClient()
+
+	route := BuilderRoute{Version: "v1"}
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderRoute([]BuilderRoute{route}))
+
+	// the version of a built route wins, the default is used when the Gateway API is not served
+	for kind, want := range map[string]string{HTTPRouteKind: "v1", GRPCRouteKind: "v1alpha2"} {
+		version, err := b.routeVersion(kind)
+		if err != nil {
+			t.Fatalf("routeVersion(%s) error = %v", kind, err)
+		}
+		if version != want {
+			t.Errorf("routeVersion(%s) = %s, want %s", kind, version, want)
+		}
+	}
+}
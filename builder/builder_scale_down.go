@@ -0,0 +1,279 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The progress of a scale down is persisted on the statefulset, so it survives operator restarts.
+const (
+	decommissioningAnnotation = "operator-runtime.datainfra.io/decommissioning"
+	scaledDownFromAnnotation  = "operator-runtime.datainfra.io/scaled-down-from"
+
+	scaleDownCondition = "ScaleDown"
+)
+
+// ScaleDownPolicy decommissions the pods removed by lowering the replicas of a statefulset before
+// they are deleted. It does not apply to node types whose replicas are managed by an autoscaler.
+type ScaleDownPolicy struct {
+	// Decommission drains the pods being removed, the replicas are lowered once it reports them
+	// decommissioned. Defaults to lowering the replicas at once.
+	Decommission DecommissionHook
+	// DeleteReleasedClaims deletes the pvcs of the removed pods once they terminated.
+	DeleteReleasedClaims bool
+}
+
+// DecommissionHook drains the pods a scale down removes, e.g. by moving their data to the pods
+// which are kept.
+type DecommissionHook interface {
+	// Decommission starts draining the pods of the target ordinals. It is called again when the
+	// ordinals change, it is not called back when the scale down is reverted.
+	Decommission(ctx context.Context, target DecommissionTarget) error
+	// IsDecommissioned reports whether the pods of the target ordinals can be removed.
+	IsDecommissioned(ctx context.Context, target DecommissionTarget) (bool, error)
+}
+
+// DecommissionTarget is the scale down a DecommissionHook drains.
+type DecommissionTarget struct {
+	// StatefulSet is the live statefulset, it still runs the pods being removed.
+	StatefulSet *appsv1.StatefulSet
+	// Ordinals of the pods being removed, in increasing order.
+	Ordinals []int32
+	// Services are the services built by the builder.
+	Services []BuilderService
+	Client   client.Client
+}
+
+// Pods returns the names of the pods being removed.
+func (t DecommissionTarget) Pods() []string {
+	pods := make([]string, 0, len(t.Ordinals))
+	for _, ordinal := range t.Ordinals {
+		pods = append(pods, fmt.Sprintf("%s-%d", t.StatefulSet.GetName(), ordinal))
+	}
+	return pods
+}
+
+// applyScaleDown holds the replicas of the live statefulset while the pods removed by a scale down
+// are decommissioned, then lets the desired replicas through. It returns true while the pods are
+// being decommissioned.
+func (s *Builder) applyScaleDown(node BuilderDeploymentStatefulSet, desired *appsv1.StatefulSet) (bool, error) {
+
+	current := &appsv1.StatefulSet{}
+	if err := node.Client.Get(s.Context.Context, *namespacedName(desired.GetName(), desired.GetNamespace()), current); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	policy := node.ScaleDown
+	conditionType := scaleDownCondition + "." + desired.GetName()
+
+	replicas := statefulSetReplicas(desired)
+	liveReplicas := statefulSetReplicas(current)
+	scaledDownFrom, _ := strconv.ParseInt(current.GetAnnotations()[scaledDownFromAnnotation], 10, 32)
+
+	if replicas >= liveReplicas {
+		if policy.DeleteReleasedClaims && scaledDownFrom > int64(replicas) {
+			// the claims of the removed pods are released once the pods terminated, the status
+			// only reflects the lowered replicas once the statefulset controller observed them
+			if current.Status.ObservedGeneration < current.GetGeneration() || current.Status.Replicas > replicas {
+				setStatefulSetAnnotation(desired, scaledDownFromAnnotation, strconv.FormatInt(scaledDownFrom, 10))
+				return true, nil
+			}
+			deleted, err := s.deleteReleasedClaims(current, replicas, int32(scaledDownFrom))
+			if err != nil {
+				return false, err
+			}
+			// a claim is kept until its snapshot is ready
+			if !deleted {
+				setStatefulSetAnnotation(desired, scaledDownFromAnnotation, strconv.FormatInt(scaledDownFrom, 10))
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	target := DecommissionTarget{
+		StatefulSet: current,
+		Services:    s.Service,
+		Client:      node.Client,
+	}
+	for ordinal := replicas; ordinal < liveReplicas; ordinal++ {
+		target.Ordinals = append(target.Ordinals, ordinal)
+	}
+	ordinals := joinOrdinals(target.Ordinals)
+
+	if policy.Decommission != nil {
+
+		if current.GetAnnotations()[decommissioningAnnotation] != ordinals {
+			if err := policy.Decommission.Decommission(s.Context.Context, target); err != nil {
+				s.setCondition(conditionType, metav1.ConditionFalse, "DecommissionFailed", err.Error())
+				return false, err
+			}
+			s.Recorder.scaleDownEvent(node.CrObject, current, v1.EventTypeNormal, fmt.Sprintf("decommission of pods [%s] started", strings.Join(target.Pods(), ", ")))
+		}
+
+		decommissioned, err := policy.Decommission.IsDecommissioned(s.Context.Context, target)
+		if err != nil {
+			s.setCondition(conditionType, metav1.ConditionFalse, "DecommissionFailed", err.Error())
+			return false, err
+		}
+
+		if !decommissioned {
+			desired.Spec.Replicas = &liveReplicas
+			setStatefulSetAnnotation(desired, decommissioningAnnotation, ordinals)
+			if scaledDownFrom > 0 {
+				setStatefulSetAnnotation(desired, scaledDownFromAnnotation, strconv.FormatInt(scaledDownFrom, 10))
+			}
+			s.setCondition(conditionType, metav1.ConditionUnknown, "Decommissioning", fmt.Sprintf("Pods [%s] are being decommissioned", strings.Join(target.Pods(), ", ")))
+			return true, nil
+		}
+
+		s.Recorder.scaleDownEvent(node.CrObject, current, v1.EventTypeNormal, fmt.Sprintf("pods [%s] decommissioned", strings.Join(target.Pods(), ", ")))
+	}
+
+	if policy.DeleteReleasedClaims {
+		if int64(liveReplicas) > scaledDownFrom {
+			scaledDownFrom = int64(liveReplicas)
+		}
+		setStatefulSetAnnotation(desired, scaledDownFromAnnotation, strconv.FormatInt(scaledDownFrom, 10))
+	}
+
+	s.setCondition(conditionType, metav1.ConditionTrue, "ScaledDown", fmt.Sprintf("Scaled down from [%d] to [%d] replicas", liveReplicas, replicas))
+	return false, nil
+}
+
+// deleteReleasedClaims deletes the pvcs created from the volume claim templates for the ordinals
+// between replicas and scaledDownFrom, with the deletion policy recorded on each of them. Claims
+// the statefulset controller deletes itself are left to it. It returns true once every claim is
+// deleted or released.
+func (s *Builder) deleteReleasedClaims(sts *appsv1.StatefulSet, replicas, scaledDownFrom int32) (bool, error) {
+
+	if retention := sts.Spec.PersistentVolumeClaimRetentionPolicy; retention != nil &&
+		retention.WhenScaled == appsv1.DeletePersistentVolumeClaimRetentionPolicyType {
+		return true, nil
+	}
+
+	released := true
+	for _, template := range sts.Spec.VolumeClaimTemplates {
+		for ordinal := replicas; ordinal < scaledDownFrom; ordinal++ {
+			claim := &v1.PersistentVolumeClaim{}
+			name := fmt.Sprintf("%s-%s-%d", template.GetName(), sts.GetName(), ordinal)
+			if err := s.Store.Client.Get(s.Context.Context, *namespacedName(name, sts.GetNamespace()), claim); err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return false, err
+			}
+			deleted, err := s.deletePvcWithPolicy(claim)
+			if err != nil {
+				return false, err
+			}
+			released = released && deleted
+		}
+	}
+
+	return released, nil
+}
+
+func statefulSetReplicas(sts *appsv1.StatefulSet) int32 {
+	if sts.Spec.Replicas == nil {
+		return 1
+	}
+	return *sts.Spec.Replicas
+}
+
+func setStatefulSetAnnotation(sts *appsv1.StatefulSet, key, value string) {
+	annotations := make(map[string]string, len(sts.GetAnnotations())+1)
+	for k, v := range sts.GetAnnotations() {
+		annotations[k] = v
+	}
+	annotations[key] = value
+	sts.SetAnnotations(annotations)
+}
+
+func joinOrdinals(ordinals []int32) string {
+	values := make([]string, 0, len(ordinals))
+	for _, ordinal := range ordinals {
+		values = append(values, strconv.Itoa(int(ordinal)))
+	}
+	return strings.Join(values, ",")
+}
+
+// HTTPDecommissionHook decommissions each pod through its own endpoint, the pods are addressed by
+// their stable network identity under the governing service of the statefulset.
+type HTTPDecommissionHook struct {
+	Port int32
+	// Scheme is http or https, defaults to http.
+	Scheme string
+	// Path is requested on each pod to start its decommission.
+	Path string
+	// Method of the decommission request, defaults to POST.
+	Method string
+	// StatusPath is requested on each pod, the pod is decommissioned once the JSONPath of the
+	// response equals Expected, or on any successful response when JSONPath is empty.
+	StatusPath string
+	JSONPath   string
+	Expected   string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (h *HTTPDecommissionHook) Decommission(ctx context.Context, target DecommissionTarget) error {
+
+	method := h.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	for _, pod := range target.Pods() {
+		url, err := h.url(target, pod, h.Path)
+		if err != nil {
+			return err
+		}
+		if err := probeHTTP(ctx, h.HTTPClient, method, url, "", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *HTTPDecommissionHook) IsDecommissioned(ctx context.Context, target DecommissionTarget) (bool, error) {
+
+	for _, pod := range target.Pods() {
+		url, err := h.url(target, pod, h.StatusPath)
+		if err != nil {
+			return false, err
+		}
+		// a pod still draining is not an error
+		if err := probeHTTP(ctx, h.HTTPClient, http.MethodGet, url, h.JSONPath, h.Expected); err != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (h *HTTPDecommissionHook) url(target DecommissionTarget, pod, path string) (string, error) {
+
+	serviceName := target.StatefulSet.Spec.ServiceName
+	if serviceName == "" {
+		return "", fmt.Errorf("statefulset [%s] has no governing service", target.StatefulSet.GetName())
+	}
+
+	scheme := h.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s.%s.%s.svc:%d/%s", scheme, pod, serviceName, target.StatefulSet.GetNamespace(), h.Port, strings.TrimPrefix(path, "/")), nil
+}
@@ -0,0 +1,265 @@
+package builder
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fakeDecommissionHook counts the decommissions started and reports the pods decommissioned once done.
+type fakeDecommissionHook struct {
+	started int
+	done    bool
+}
+
+func (h *fakeDecommissionHook) Decommission(ctx context.Context, target DecommissionTarget) error {
+	h.started++
+	return nil
+}
+
+func (h *fakeDecommissionHook) IsDecommissioned(ctx context.Context, target DecommissionTarget) (bool, error) {
+	return h.done, nil
+}
+
+func TestApplyScaleDown(t *testing.T) {
+
+	cr := newTestCr()
+
+	observed := func(replicas int32) appsv1.StatefulSetStatus {
+		return appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: replicas}
+	}
+	deleteWhenScaled := &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+		WhenDeleted: appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+		WhenScaled:  appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+	}
+
+	tests := []struct {
+		name           string
+		live           int32
+		desired        int32
+		annotations    map[string]string
+		status         appsv1.StatefulSetStatus
+		retention      *appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy
+		claimPolicy    StorageDeletionPolicy
+		decommissioned bool
+		deleteClaims   bool
+		// want
+		decommissioning bool
+		replicas        int32
+		started         int
+		scaledDownFrom  string
+		claimDeleted    bool
+		claimReleased   bool
+	}{
+		{
+			name:     "scale up",
+			live:     2,
+			desired:  3,
+			replicas: 3,
+		},
+		{
+			name:            "decommission starts",
+			live:            3,
+			desired:         2,
+			decommissioning: true,
+			replicas:        3,
+			started:         1,
+		},
+		{
+			name:            "decommission in progress is not started again",
+			live:            3,
+			desired:         2,
+			annotations:     map[string]string{decommissioningAnnotation: "2"},
+			decommissioning: true,
+			replicas:        3,
+		},
+		{
+			name:           "decommissioned pods are removed",
+			live:           3,
+			desired:        2,
+			annotations:    map[string]string{decommissioningAnnotation: "2"},
+			decommissioned: true,
+			deleteClaims:   true,
+			replicas:       2,
+			scaledDownFrom: "3",
+		},
+		{
+			name:            "claims wait for the scale down to be observed",
+			live:            2,
+			desired:         2,
+			annotations:     map[string]string{scaledDownFromAnnotation: "3"},
+			status:          appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 2},
+			deleteClaims:    true,
+			decommissioning: true,
+			replicas:        2,
+			scaledDownFrom:  "3",
+		},
+		{
+			name:            "claims wait for the pods to terminate",
+			live:            2,
+			desired:         2,
+			annotations:     map[string]string{scaledDownFromAnnotation: "3"},
+			status:          observed(3),
+			deleteClaims:    true,
+			decommissioning: true,
+			replicas:        2,
+			scaledDownFrom:  "3",
+		},
+		{
+			name:         "released claims are deleted",
+			live:         2,
+			desired:      2,
+			annotations:  map[string]string{scaledDownFromAnnotation: "3"},
+			status:       observed(2),
+			deleteClaims: true,
+			replicas:     2,
+			claimDeleted: true,
+		},
+		{
+			name:          "released claims are retained by their deletion policy",
+			live:          2,
+			desired:       2,
+			annotations:   map[string]string{scaledDownFromAnnotation: "3"},
+			status:        observed(2),
+			claimPolicy:   StorageDeletionPolicyRetain,
+			deleteClaims:  true,
+			replicas:      2,
+			claimReleased: true,
+		},
+		{
+			name:            "released claims wait for their snapshot",
+			live:            2,
+			desired:         2,
+			annotations:     map[string]string{scaledDownFromAnnotation: "3"},
+			status:          observed(2),
+			claimPolicy:     StorageDeletionPolicySnapshotThenDelete,
+			deleteClaims:    true,
+			decommissioning: true,
+			replicas:        2,
+			scaledDownFrom:  "3",
+		},
+		{
+			name:         "released claims are left to the statefulset retention policy",
+			live:         2,
+			desired:      2,
+			annotations:  map[string]string{scaledDownFromAnnotation: "3"},
+			status:       observed(2),
+			retention:    deleteWhenScaled,
+			deleteClaims: true,
+			replicas:     2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			live := newTestStatefulSet(cr, "data")
+			live.Generation = 2
+			live.Annotations = tt.annotations
+			live.Spec.Replicas = &tt.live
+			live.Spec.PersistentVolumeClaimRetentionPolicy = tt.retention
+			live.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "data"}}}
+			live.Status = tt.status
+
+			annotations := map[string]string{}
+			if tt.claimPolicy != "" {
+				annotations[deletionPolicyAnnotation] = string(tt.claimPolicy)
+			}
+			claim := newTestPvc(cr, "data-data-2", annotations)
+
+			c := newTestClient(cr.DeepCopy(), live, claim.DeepCopy())
+			hook := &fakeDecommissionHook{done: tt.decommissioned}
+
+			node := newTestNode(c, cr, "data", "Statefulset")
+			node.Replicas = tt.desired
+			node.ScaleDown = &ScaleDownPolicy{Decommission: hook, DeleteReleasedClaims: tt.deleteClaims}
+
+			b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder())
+
+			desired, err := node.MakeStatefulSet()
+			if err != nil {
+				t.Fatalf("MakeStatefulSet() error = %v", err)
+			}
+
+			decommissioning, err := b.applyScaleDown(node, desired)
+			if err != nil {
+				t.Fatalf("applyScaleDown() error = %v", err)
+			}
+			if decommissioning != tt.decommissioning {
+				t.Errorf("decommissioning = %v, want %v", decommissioning, tt.decommissioning)
+			}
+			if replicas := statefulSetReplicas(desired); replicas != tt.replicas {
+				t.Errorf("replicas = %d, want %d", replicas, tt.replicas)
+			}
+			if hook.started != tt.started {
+				t.Errorf("decommissions started = %d, want %d", hook.started, tt.started)
+			}
+			if scaledDownFrom := desired.GetAnnotations()[scaledDownFromAnnotation]; scaledDownFrom != tt.scaledDownFrom {
+				t.Errorf("scaled down from = %q, want %q", scaledDownFrom, tt.scaledDownFrom)
+			}
+
+			stored := &v1.PersistentVolumeClaim{}
+			err = c.Get(context.Background(), client.ObjectKeyFromObject(claim), stored)
+			if deleted := err != nil; deleted != tt.claimDeleted {
+				t.Fatalf("claim deleted = %v, want %v", deleted, tt.claimDeleted)
+			}
+			if !tt.claimDeleted {
+				if released := !metav1.IsControlledBy(stored, cr); released != tt.claimReleased {
+					t.Errorf("claim released = %v, want %v", released, tt.claimReleased)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileStoreKeepsNodeTypesWhileDecommissioning(t *testing.T) {
+
+	cr := newTestCr()
+
+	replicas := int32(3)
+	live := newTestStatefulSet(cr, "data")
+	live.Spec.Replicas = &replicas
+	c := newTestClient(cr.DeepCopy(), live, newTestDeployment(cr, "query"))
+
+	// the first reconcile updates the statefulset, the second one waits for the decommission, every
+	// reconcile starts from a new builder
+	var b *Builder
+	var result Result
+	for i := 0; i < 2; i++ {
+		node := newTestNode(c, cr, "data", "Statefulset")
+		node.Replicas = 2
+		node.ScaleDown = &ScaleDownPolicy{Decommission: &fakeDecommissionHook{}}
+
+		b = newTestBuilder(c, cr.DeepCopy(), newTestRecorder(), ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{
+			node,
+			newTestNode(c, cr, "query", "Deployment"),
+		}))
+
+		var err error
+		if result, err = b.ReconcileDeployOrSts(); err != nil {
+			t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+		}
+	}
+
+	if !result.RolloutInProgress {
+		t.Fatalf("RolloutInProgress = false, want true")
+	}
+	if err := b.ReconcileStore(); err != nil {
+		t.Fatalf("ReconcileStore() error = %v", err)
+	}
+
+	stored := &appsv1.StatefulSet{}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(live), stored); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got := statefulSetReplicas(stored); got != replicas {
+		t.Errorf("replicas = %d while decommissioning, want %d", got, replicas)
+	}
+	if !exists(c, newTestDeployment(cr, "query")) {
+		t.Errorf("node type after a decommissioning statefulset was collected")
+	}
+}
@@ -0,0 +1,191 @@
+package builder
+
+import (
+	"crypto/rand"
+	"math/big"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	secretGeneratedAtAnnotation     = "operator-runtime.datainfra.io/generated-at"
+	secretRotationTriggerAnnotation = "operator-runtime.datainfra.io/rotation-trigger"
+
+	defaultSecretLength  = 32
+	defaultSecretCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+type BuilderSecret struct {
+	Data map[string][]byte
+	Type v1.SecretType
+	// Generate holds the keys whose values are generated randomly, a value is only generated
+	// once and preserved across reconciles until it is rotated.
+	Generate []SecretGenerate
+	// Rotation regenerates the generated values, workloads consuming the secret are rolled out.
+	Rotation *SecretRotationPolicy
+	CommonBuilder
+}
+
+// SecretGenerate describes a generated secret value.
+type SecretGenerate struct {
+	Key string
+	// Length defaults to 32.
+	Length int
+	// Charset defaults to alphanumeric characters.
+	Charset string
+}
+
+// SecretRotationPolicy decides when generated values are regenerated.
+type SecretRotationPolicy struct {
+	// MaxAge regenerates the values once they are older, zero disables rotation by age.
+	MaxAge time.Duration
+	// TriggerAnnotation names an annotation on the custom resource, any change of its
+	// value regenerates the values.
+	TriggerAnnotation string
+}
+
+func ToNewBuilderSecret(builder []BuilderSecret) func(*Builder) {
+	return func(s *Builder) {
+		s.Secrets = builder
+	}
+}
+
+func (s *Builder) ReconcileSecret() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(secret))
+
+	for _, sec := range s.Secrets {
+
+		current := &v1.Secret{}
+		if err := sec.Client.Get(s.Context.Context, *namespacedName(sec.ObjectMeta.Name, sec.ObjectMeta.Namespace), current); err != nil {
+			if !apierrors.IsNotFound(err) {
+				result.add(string(secret), sec.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+				continue
+			}
+			current = nil
+		}
+
+		desired, rotated, err := sec.makeSecret(current)
+		if err != nil {
+			result.add(string(secret), sec.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			continue
+		}
+
+		s.Put(desired.GetName(), desired.Kind)
+
+		sec.DesiredState = desired
+		sec.CurrentState = &v1.Secret{}
+
+		operation, err := sec.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(desired.Kind, desired.GetName(), operation, err)
+		if err == nil && rotated {
+			s.Recorder.rotateEvent(sec.CrObject, desired)
+		}
+	}
+
+	return result, result.Err()
+}
+
+// makeSecret builds the desired secret, generated values are taken over from the live secret
+// unless they are rotated. It reports whether existing values were rotated.
+func (b *BuilderSecret) makeSecret(current *v1.Secret) (*v1.Secret, bool, error) {
+
+	objectMeta := *b.ObjectMeta.DeepCopy()
+	if objectMeta.Annotations == nil {
+		objectMeta.Annotations = make(map[string]string)
+	}
+
+	data := make(map[string][]byte, len(b.Data)+len(b.Generate))
+	for key, value := range b.Data {
+		data[key] = value
+	}
+
+	rotate := current != nil && b.shouldRotate(current)
+
+	generatedAt := ""
+	if current != nil {
+		generatedAt = current.GetAnnotations()[secretGeneratedAtAnnotation]
+	}
+
+	for _, generate := range b.Generate {
+		if current != nil && !rotate {
+			if value, ok := current.Data[generate.Key]; ok {
+				data[generate.Key] = value
+				continue
+			}
+		}
+
+		value, err := generateSecretValue(generate)
+		if err != nil {
+			return nil, false, err
+		}
+		data[generate.Key] = value
+		generatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	if len(b.Generate) > 0 {
+		objectMeta.Annotations[secretGeneratedAtAnnotation] = generatedAt
+		if b.Rotation != nil && b.Rotation.TriggerAnnotation != "" {
+			objectMeta.Annotations[secretRotationTriggerAnnotation] = b.CrObject.GetAnnotations()[b.Rotation.TriggerAnnotation]
+		}
+	}
+
+	return &v1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: objectMeta,
+		Type:       b.Type,
+		Data:       data,
+	}, rotate, nil
+}
+
+func (b *BuilderSecret) shouldRotate(current *v1.Secret) bool {
+	if b.Rotation == nil || len(b.Generate) == 0 {
+		return false
+	}
+
+	if b.Rotation.TriggerAnnotation != "" {
+		if b.CrObject.GetAnnotations()[b.Rotation.TriggerAnnotation] != current.GetAnnotations()[secretRotationTriggerAnnotation] {
+			return true
+		}
+	}
+
+	if b.Rotation.MaxAge > 0 {
+		generatedAt, err := time.Parse(time.RFC3339Nano, current.GetAnnotations()[secretGeneratedAtAnnotation])
+		if err != nil || time.Since(generatedAt) > b.Rotation.MaxAge {
+			return true
+		}
+	}
+
+	return false
+}
+
+func generateSecretValue(generate SecretGenerate) ([]byte, error) {
+	length := generate.Length
+	if length <= 0 {
+		length = defaultSecretLength
+	}
+	charset := generate.Charset
+	if charset == "" {
+		charset = defaultSecretCharset
+	}
+
+	value := make([]byte, length)
+	max := big.NewInt(int64(len(charset)))
+	for i := range value {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return nil, err
+		}
+		value[i] = charset[n.Int64()]
+	}
+	return value, nil
+}
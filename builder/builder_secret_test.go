@@ -0,0 +1,92 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestSecret(c client.Client, cr client.Object) BuilderSecret {
+	return BuilderSecret{
+		Data:          map[string][]byte{"user": []byte("druid")},
+		Generate:      []SecretGenerate{{Key: "password", Length: 16}},
+		Rotation:      &SecretRotationPolicy{TriggerAnnotation: "rotate"},
+		CommonBuilder: newTestCommonBuilder(c, cr, "credentials"),
+	}
+}
+
+func TestReconcileSecretGeneratesAndRotates(t *testing.T) {
+
+	cr := newTestCr()
+	c := newTestClient(cr.DeepCopy())
+
+	reconcile := func() *v1.Secret {
+		t.Helper()
+		b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderSecret([]BuilderSecret{newTestSecret(c, cr)}))
+		if _, err := b.ReconcileSecret(); err != nil {
+			t.Fatalf("ReconcileSecret() error = %v", err)
+		}
+		live := &v1.Secret{}
+		if err := c.Get(context.Background(), objectKey("credentials"), live); err != nil {
+			t.Fatal(err)
+		}
+		return live
+	}
+
+	generated := reconcile()
+	if len(generated.Data["password"]) != 16 || string(generated.Data["user"]) != "druid" {
+		t.Fatalf("secret data = %q, want a generated password of 16 characters and the user", generated.Data)
+	}
+
+	if kept := reconcile(); !bytes.Equal(kept.Data["password"], generated.Data["password"]) {
+		t.Error("generated password changed without a rotation")
+	}
+
+	cr.Annotations = map[string]string{"rotate": "1"}
+	if rotated := reconcile(); bytes.Equal(rotated.Data["password"], generated.Data["password"]) {
+		t.Error("generated password was not rotated by the trigger annotation")
+	}
+}
+
+func TestSecretRotationRollsOutWorkloads(t *testing.T) {
+
+	cr := newTestCr()
+	c := newTestClient(cr.DeepCopy())
+
+	reconcile := func() string {
+		t.Helper()
+		node := newTestNode(c, cr, "broker", "Deployment")
+		node.PodSpec.Containers[0].EnvFrom = []v1.EnvFromSource{
+			{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "credentials"}}},
+		}
+		b := newTestBuilder(c, cr, newTestRecorder(),
+			ToNewBuilderSecret([]BuilderSecret{newTestSecret(c, cr)}),
+			ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{node}),
+		)
+		if _, err := b.ReconcileSecret(); err != nil {
+			t.Fatalf("ReconcileSecret() error = %v", err)
+		}
+		if _, err := b.ReconcileDeployOrSts(); err != nil {
+			t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+		}
+		live := &appsv1.Deployment{}
+		if err := c.Get(context.Background(), objectKey("broker"), live); err != nil {
+			t.Fatal(err)
+		}
+		return live.Spec.Template.Annotations[podTemplateConfigHashAnnotation]
+	}
+
+	revision := reconcile()
+	if revision == "" {
+		t.Fatal("pod template does not record the config hash")
+	}
+
+	cr.Annotations = map[string]string{"rotate": "1"}
+	if rotated := reconcile(); rotated == revision {
+		t.Errorf("pod template config hash = %q after a rotation, want it changed", rotated)
+	}
+}
@@ -3,7 +3,6 @@ package builder
 import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 type BuilderService struct {
@@ -17,10 +16,11 @@ func ToNewBuilderService(builder []BuilderService) func(*Builder) {
 		s.Service = builder
 	}
 }
-func (s *Builder) ReconcileService() (controllerutil.OperationResult, error) {
+func (s *Builder) ReconcileService() (Result, error) {
 
-	var err error
-	var result controllerutil.OperationResult
+	var result Result
+
+	s.manageKind(string(svc))
 
 	for _, svc := range s.Service {
 
@@ -28,16 +28,16 @@ func (s *Builder) ReconcileService() (controllerutil.OperationResult, error) {
 
 			makeSvc := svc.makeService()
 
+			s.Put(makeSvc.GetName(), makeSvc.Kind)
+
 			svc.DesiredState = makeSvc
 			svc.CurrentState = &v1.Service{}
 
-			result, err = svc.CreateOrUpdate(s.Context.Context, s.Recorder)
-			if err != nil {
-				return controllerutil.OperationResultNone, nil
-			}
+			operation, err := svc.CreateOrUpdate(s.Context.Context, s.Recorder)
+			result.add(makeSvc.Kind, makeSvc.GetName(), operation, err)
 		}
 	}
-	return result, nil
+	return result, result.Err()
 }
 
 func (b *BuilderService) makeService() *v1.Service {
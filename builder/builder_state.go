@@ -8,14 +8,26 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 func (b *CommonBuilder) CreateOrUpdate(ctx context.Context, buildRecorder BuilderRecorder) (controllerutil.OperationResult, error) {
-	addOwnerRefToObject(b.DesiredState, b.OwnerRef)
+	// cluster scoped objects cannot be owned by a namespaced custom resource
+	if b.DesiredState.GetNamespace() == "" {
+		markClusterScoped(b.DesiredState, b.OwnerRef)
+	} else {
+		addOwnerRefToObject(b.DesiredState, b.OwnerRef)
+	}
 	utils.AddHashToObject(b.DesiredState, b.OwnerRef.Kind+"OperatorHash")
+	if b.ServerSideApply != nil {
+		return b.Apply(ctx, buildRecorder)
+	}
 	if err := b.Client.Get(ctx, types.NamespacedName{Name: b.DesiredState.GetName(), Namespace: b.DesiredState.GetNamespace()}, b.CurrentState); err != nil {
 		if apierrors.IsNotFound(err) {
+			if b.beforeWrite != nil {
+				b.beforeWrite(b.DesiredState, nil)
+			}
 			result, err := b.Create(ctx, buildRecorder)
 			if err != nil {
 				return controllerutil.OperationResultNone, err
@@ -25,11 +37,22 @@ func (b *CommonBuilder) CreateOrUpdate(ctx context.Context, buildRecorder Builde
 			return "", err
 		}
 	} else {
-		if b.DesiredState.GetAnnotations()[b.OwnerRef.Kind+"OperatorHash"] != b.CurrentState.GetAnnotations()[b.OwnerRef.Kind+"OperatorHash"] {
+		// the object is being recreated, wait for its deletion to complete
+		if b.CurrentState.GetDeletionTimestamp() != nil {
+			return controllerutil.OperationResultNone, nil
+		}
+		drifted, err := b.isDriftedFromDesired(buildRecorder)
+		if err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		if drifted || b.DesiredState.GetAnnotations()[b.OwnerRef.Kind+"OperatorHash"] != b.CurrentState.GetAnnotations()[b.OwnerRef.Kind+"OperatorHash"] {
 			b.DesiredState.SetResourceVersion(b.CurrentState.GetResourceVersion())
+			if b.beforeWrite != nil {
+				b.beforeWrite(b.DesiredState, b.CurrentState)
+			}
 			result, err := b.Update(ctx, buildRecorder)
 			if err != nil {
-				return controllerutil.OperationResultNone, err
+				return b.handleUpdateError(ctx, buildRecorder, err)
 			} else {
 				return result, nil
 			}
@@ -39,6 +62,34 @@ func (b *CommonBuilder) CreateOrUpdate(ctx context.Context, buildRecorder Builde
 	}
 }
 
+// chainBeforeWrite runs the adjustments made before a write in order, nil ones are skipped.
+func chainBeforeWrite(fns ...func(desired, current client.Object)) func(desired, current client.Object) {
+	return func(desired, current client.Object) {
+		for _, fn := range fns {
+			if fn != nil {
+				fn(desired, current)
+			}
+		}
+	}
+}
+
+// isDriftedFromDesired is only evaluated when drift detection is enabled and the hash of the
+// live object matches the desired state, a detected drift emits a drift event.
+func (b *CommonBuilder) isDriftedFromDesired(buildRecorder BuilderRecorder) (bool, error) {
+	if !b.DetectDrift || b.DesiredState.GetAnnotations()[b.OwnerRef.Kind+"OperatorHash"] != b.CurrentState.GetAnnotations()[b.OwnerRef.Kind+"OperatorHash"] {
+		return false, nil
+	}
+
+	drifted, err := isDrifted(b.DesiredState, b.CurrentState)
+	if err != nil {
+		return false, err
+	}
+	if drifted {
+		buildRecorder.driftEvent(b.CrObject, b.CurrentState)
+	}
+	return drifted, nil
+}
+
 func addOwnerRefToObject(obj metav1.Object, ownerRef metav1.OwnerReference) {
 	trueVar := true
 	ownerRef = metav1.OwnerReference{
@@ -0,0 +1,25 @@
+package builder
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BuilderStatus holds the conditions observed by the builder during a reconcile, operators
+// copy them into the status of their custom resource.
+type BuilderStatus struct {
+	Conditions []metav1.Condition
+}
+
+func (s *Builder) setCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	condition := metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+	if s.Store.CrObject != nil {
+		condition.ObservedGeneration = s.Store.CrObject.GetGeneration()
+	}
+	meta.SetStatusCondition(&s.Status.Conditions, condition)
+}
@@ -1,13 +1,53 @@
 package builder
 
 import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// StorageDeletionPolicy decides what happens to a pvc once it is not desired anymore.
+type StorageDeletionPolicy string
+
+const (
+	// StorageDeletionPolicyDelete deletes the pvc, this is the default.
+	StorageDeletionPolicyDelete StorageDeletionPolicy = "Delete"
+	// StorageDeletionPolicyRetain releases the pvc from the custom resource and keeps it.
+	StorageDeletionPolicyRetain StorageDeletionPolicy = "Retain"
+	// StorageDeletionPolicySnapshotThenDelete takes a VolumeSnapshot of the pvc and
+	// deletes the pvc once the snapshot is ready to use.
+	StorageDeletionPolicySnapshotThenDelete StorageDeletionPolicy = "SnapshotThenDelete"
+)
+
+const (
+	deletionPolicyAnnotation   = "operator-runtime.datainfra.io/deletion-policy"
+	snapshotClassAnnotation    = "operator-runtime.datainfra.io/volume-snapshot-class"
+	statefulSetOwnerAnnotation = "operator-runtime.datainfra.io/statefulset"
+	snapshotSourceLabel        = "operator-runtime.datainfra.io/snapshot-of"
+	volumeSnapshotNameSuffix   = "-final-snapshot"
+)
+
+var volumeSnapshotGVK = schema.GroupVersionKind{
+	Group:   "snapshot.storage.k8s.io",
+	Version: "v1",
+	Kind:    "VolumeSnapshot",
+}
+
 type BuilderStorageConfig struct {
 	PvcSpec *v1.PersistentVolumeClaimSpec
+	// DeletionPolicy is enforced when the pvc is garbage collected or the custom
+	// resource is finalized. When unset the pvc is deleted along with its owner.
+	DeletionPolicy StorageDeletionPolicy
+	// VolumeSnapshotClassName is used by the SnapshotThenDelete policy, the cluster
+	// default snapshot class is used when empty.
+	VolumeSnapshotClassName string
 	CommonBuilder
 }
 
@@ -17,35 +57,195 @@ func ToNewBuilderStorageConfig(builder []BuilderStorageConfig) func(*Builder) {
 	}
 }
 
-func (s *Builder) ReconcileStorage() (controllerutil.OperationResult, error) {
+func (s *Builder) ReconcileStorage() (Result, error) {
+
+	var result Result
+
+	s.manageKind(string(pvc))
 
 	for _, storage := range s.StorageConfig {
 
 		pvc, err := storage.MakePvc()
 		if err != nil {
-			return controllerutil.OperationResultNone, err
+			result.add("PersistentVolumeClaim", storage.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			continue
 		}
 
+		s.Put(pvc.GetName(), pvc.Kind)
+
 		storage.DesiredState = pvc
 		storage.CurrentState = &v1.PersistentVolumeClaim{}
 
-		_, err = storage.CreateOrUpdate(s.Context.Context, s.Recorder)
-		if err != nil {
-			return controllerutil.OperationResultNone, nil
-		}
-
+		operation, err := storage.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(pvc.Kind, pvc.GetName(), operation, err)
 	}
 
-	return controllerutil.OperationResultNone, nil
+	return result, result.Err()
 }
 
 func (b *BuilderStorageConfig) MakePvc() (*v1.PersistentVolumeClaim, error) {
+	objectMeta := *b.ObjectMeta.DeepCopy()
+
+	if b.DeletionPolicy != "" {
+		if objectMeta.Annotations == nil {
+			objectMeta.Annotations = make(map[string]string)
+		}
+		objectMeta.Annotations[deletionPolicyAnnotation] = string(b.DeletionPolicy)
+		if b.VolumeSnapshotClassName != "" {
+			objectMeta.Annotations[snapshotClassAnnotation] = b.VolumeSnapshotClassName
+		}
+	}
+
 	return &v1.PersistentVolumeClaim{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
 			Kind:       "PersistentVolumeClaim",
 		},
-		ObjectMeta: b.ObjectMeta,
+		ObjectMeta: objectMeta,
 		Spec:       *b.PvcSpec,
 	}, nil
 }
+
+// FinalizeStorage enforces the deletion policy of every pvc with an explicit policy, including
+// the pvcs created from statefulset volume claim templates. It is meant to be called from the
+// finalizer of the custom resource and returns true once all pvcs are handled, false means
+// snapshots are still being taken and the finalizer should be retried.
+func (s *Builder) FinalizeStorage() (bool, error) {
+
+	s.Store.CommonBuilder.ObjectList = &v1.PersistentVolumeClaimList{}
+	list, err := s.Store.List(s.Context.Context, s.Recorder)
+	if err != nil {
+		return false, err
+	}
+
+	done := true
+	for i := range list.(*v1.PersistentVolumeClaimList).Items {
+		claim := &list.(*v1.PersistentVolumeClaimList).Items[i]
+		if _, ok := claim.GetAnnotations()[deletionPolicyAnnotation]; !ok {
+			continue
+		}
+
+		deleted, err := s.deletePvcWithPolicy(claim)
+		if err != nil {
+			return false, err
+		}
+		done = done && deleted
+	}
+
+	return done, nil
+}
+
+// isOrphanedClaimTemplatePvc reports whether a pvc was created from the volume claim template
+// of a statefulset which is neither desired anymore nor present in the cluster. Only pvcs of
+// templates with an explicit deletion policy carry the statefulset annotation.
+func (s *Builder) isOrphanedClaimTemplatePvc(claim *v1.PersistentVolumeClaim) (bool, error) {
+	stsName, ok := claim.GetAnnotations()[statefulSetOwnerAnnotation]
+	if !ok || !s.Store.ManagedKinds[string(statefulSet)] || s.Exists(stsName, string(statefulSet)) {
+		return false, nil
+	}
+
+	// the pvc backs the statefulset until it is gone, including while it is being deleted
+	sts := &appsv1.StatefulSet{}
+	if err := s.Store.Client.Get(s.Context.Context, *namespacedName(stsName, claim.GetNamespace()), sts); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// deletePvcWithPolicy enforces the deletion policy recorded on the pvc, it returns true once
+// the pvc is deleted or released.
+func (s *Builder) deletePvcWithPolicy(claim *v1.PersistentVolumeClaim) (bool, error) {
+
+	if claim.GetDeletionTimestamp() != nil {
+		return true, nil
+	}
+
+	switch StorageDeletionPolicy(claim.GetAnnotations()[deletionPolicyAnnotation]) {
+	case StorageDeletionPolicyRetain:
+		return true, s.releasePvc(claim)
+	case StorageDeletionPolicySnapshotThenDelete:
+		ready, err := s.snapshotPvc(claim)
+		if err != nil || !ready {
+			return false, err
+		}
+	}
+
+	s.Store.CommonBuilder.DesiredState = claim
+	if _, err := s.Store.Delete(s.Context.Context, s.Recorder); err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// releasePvc removes the owner reference of the custom resource and the runtime annotations,
+// so the pvc neither gets garbage collected nor deleted along with the custom resource.
+func (s *Builder) releasePvc(claim *v1.PersistentVolumeClaim) error {
+
+	patch := client.MergeFrom(claim.DeepCopy())
+
+	var ownerRefs []metav1.OwnerReference
+	for _, ownerRef := range claim.GetOwnerReferences() {
+		if s.Store.CrObject != nil && ownerRef.UID == s.Store.CrObject.GetUID() {
+			continue
+		}
+		ownerRefs = append(ownerRefs, ownerRef)
+	}
+	claim.SetOwnerReferences(ownerRefs)
+
+	annotations := claim.GetAnnotations()
+	delete(annotations, deletionPolicyAnnotation)
+	delete(annotations, statefulSetOwnerAnnotation)
+	claim.SetAnnotations(annotations)
+
+	if err := s.Store.Client.Patch(s.Context.Context, claim, patch); err != nil {
+		s.Recorder.updateEvent(s.Store.CrObject, claim, err)
+		return err
+	}
+
+	s.Recorder.GenericEvent(
+		s.Store.CrObject,
+		v1.EventTypeNormal,
+		fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], retained by deletion policy", claim.GetName(), claim.GetNamespace(), detectType(claim, s.Store.Client.Scheme())),
+		s.Recorder.ControllerName+"RetainObjectSuccess",
+	)
+	return nil
+}
+
+// snapshotPvc creates a VolumeSnapshot of the pvc if it does not exist yet and reports whether
+// the snapshot is ready to use.
+func (s *Builder) snapshotPvc(claim *v1.PersistentVolumeClaim) (bool, error) {
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+
+	err := s.Store.Client.Get(s.Context.Context, *namespacedName(claim.GetName()+volumeSnapshotNameSuffix, claim.GetNamespace()), snapshot)
+	if err == nil {
+		ready, _, err := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		return ready, err
+	} else if !apierrors.IsNotFound(err) {
+		return false, err
+	}
+
+	snapshot.SetName(claim.GetName() + volumeSnapshotNameSuffix)
+	snapshot.SetNamespace(claim.GetNamespace())
+	snapshot.SetLabels(map[string]string{snapshotSourceLabel: claim.GetName()})
+	if err := unstructured.SetNestedField(snapshot.Object, claim.GetName(), "spec", "source", "persistentVolumeClaimName"); err != nil {
+		return false, err
+	}
+	if class := claim.GetAnnotations()[snapshotClassAnnotation]; class != "" {
+		if err := unstructured.SetNestedField(snapshot.Object, class, "spec", "volumeSnapshotClassName"); err != nil {
+			return false, err
+		}
+	}
+
+	snapshotBuilder := s.Store.CommonBuilder
+	snapshotBuilder.DesiredState = snapshot
+	if _, err := snapshotBuilder.Create(s.Context.Context, s.Recorder); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
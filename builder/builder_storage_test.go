@@ -0,0 +1,174 @@
+package builder
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestPvc(cr client.Object, name string, annotations map[string]string) *v1.PersistentVolumeClaim {
+	claim := &v1.PersistentVolumeClaim{ObjectMeta: newTestObjectMeta(cr, name)}
+	claim.Annotations = annotations
+	return claim
+}
+
+func newTestSnapshot(claim string, ready bool) *unstructured.Unstructured {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	snapshot.SetName(claim + volumeSnapshotNameSuffix)
+	snapshot.SetNamespace(testNamespace)
+	_ = unstructured.SetNestedField(snapshot.Object, ready, "status", "readyToUse")
+	return snapshot
+}
+
+func TestReconcileStorePvcDeletionPolicy(t *testing.T) {
+
+	cr := newTestCr()
+
+	tests := []struct {
+		name     string
+		policy   StorageDeletionPolicy
+		existing []client.Object
+		deleted  bool
+		released bool
+		snapshot bool
+	}{
+		{
+			name:    "no policy",
+			deleted: true,
+		},
+		{
+			name:    "delete",
+			policy:  StorageDeletionPolicyDelete,
+			deleted: true,
+		},
+		{
+			name:     "retain",
+			policy:   StorageDeletionPolicyRetain,
+			released: true,
+		},
+		{
+			name:     "snapshot not taken yet",
+			policy:   StorageDeletionPolicySnapshotThenDelete,
+			snapshot: true,
+		},
+		{
+			name:     "snapshot not ready",
+			policy:   StorageDeletionPolicySnapshotThenDelete,
+			existing: []client.Object{newTestSnapshot("data", false)},
+			snapshot: true,
+		},
+		{
+			name:     "snapshot ready",
+			policy:   StorageDeletionPolicySnapshotThenDelete,
+			existing: []client.Object{newTestSnapshot("data", true)},
+			deleted:  true,
+			snapshot: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			annotations := map[string]string{}
+			if tt.policy != "" {
+				annotations[deletionPolicyAnnotation] = string(tt.policy)
+			}
+			claim := newTestPvc(cr, "data", annotations)
+
+			c := newTestClient(append([]client.Object{cr.DeepCopy(), claim.DeepCopy()}, tt.existing...)...)
+			b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder())
+
+			if _, err := b.ReconcileStorage(); err != nil {
+				t.Fatalf("ReconcileStorage() error = %v", err)
+			}
+			if err := b.ReconcileStore(); err != nil {
+				t.Fatalf("ReconcileStore() error = %v", err)
+			}
+
+			live := &v1.PersistentVolumeClaim{}
+			err := c.Get(context.Background(), client.ObjectKeyFromObject(claim), live)
+			if deleted := err != nil; deleted != tt.deleted {
+				t.Fatalf("pvc deleted = %v, want %v", deleted, tt.deleted)
+			}
+			if !tt.deleted {
+				_, annotated := live.GetAnnotations()[deletionPolicyAnnotation]
+				if released := !metav1.IsControlledBy(live, cr) && !annotated; released != tt.released {
+					t.Errorf("pvc released = %v, want %v", released, tt.released)
+				}
+			}
+
+			if snapshotted := exists(c, newTestSnapshot("data", false)); snapshotted != tt.snapshot {
+				t.Errorf("snapshot exists = %v, want %v", snapshotted, tt.snapshot)
+			}
+		})
+	}
+}
+
+func TestIsOrphanedClaimTemplatePvc(t *testing.T) {
+
+	cr := newTestCr()
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		existing    []client.Object
+		desired     bool
+		unmanaged   bool
+		orphaned    bool
+	}{
+		{
+			name: "not created from a claim template",
+		},
+		{
+			name:        "statefulset desired",
+			annotations: map[string]string{statefulSetOwnerAnnotation: "data-node"},
+			existing:    []client.Object{newTestStatefulSet(cr, "data-node")},
+			desired:     true,
+		},
+		{
+			name:        "statefulset not desired but still in the cluster",
+			annotations: map[string]string{statefulSetOwnerAnnotation: "data-node"},
+			existing:    []client.Object{newTestStatefulSet(cr, "data-node")},
+		},
+		{
+			name:        "statefulsets not managed",
+			annotations: map[string]string{statefulSetOwnerAnnotation: "data-node"},
+			unmanaged:   true,
+		},
+		{
+			name:        "statefulset gone",
+			annotations: map[string]string{statefulSetOwnerAnnotation: "data-node"},
+			orphaned:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c := newTestClient(tt.existing...)
+			b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder())
+			if !tt.unmanaged {
+				b.manageKind(string(statefulSet))
+			}
+			if tt.desired {
+				b.Put("data-node", string(statefulSet))
+			}
+
+			claim := newTestPvc(cr, "data-data-node-0", tt.annotations)
+			claim.OwnerReferences = nil
+
+			orphaned, err := b.isOrphanedClaimTemplatePvc(claim)
+			if err != nil {
+				t.Fatalf("isOrphanedClaimTemplatePvc() error = %v", err)
+			}
+			if orphaned != tt.orphaned {
+				t.Errorf("isOrphanedClaimTemplatePvc() = %v, want %v", orphaned, tt.orphaned)
+			}
+		})
+	}
+}
@@ -1,24 +1,51 @@
 package builder
 
 import (
-	v1 "k8s.io/api/apps/v1"
+	"sort"
+
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 type K8sObjectName string
 
 const (
 	// As per k8s naming
-	configMap  K8sObjectName = "ConfigMap"
-	deployment K8sObjectName = "Deployment"
-	pvc        K8sObjectName = "PersistentVolumeClaim"
-	svc        K8sObjectName = "Service"
+	configMap           K8sObjectName = "ConfigMap"
+	secret              K8sObjectName = "Secret"
+	deployment          K8sObjectName = "Deployment"
+	statefulSet         K8sObjectName = "StatefulSet"
+	daemonSet           K8sObjectName = "DaemonSet"
+	pvc                 K8sObjectName = "PersistentVolumeClaim"
+	svc                 K8sObjectName = "Service"
+	networkPolicy       K8sObjectName = "NetworkPolicy"
+	ingress             K8sObjectName = "Ingress"
+	podDisruptionBudget K8sObjectName = "PodDisruptionBudget"
+	hpa                 K8sObjectName = "HorizontalPodAutoscaler"
+	serviceAccount      K8sObjectName = "ServiceAccount"
+	role                K8sObjectName = "Role"
+	roleBinding         K8sObjectName = "RoleBinding"
+	clusterRole         K8sObjectName = "ClusterRole"
+	clusterRoleBinding  K8sObjectName = "ClusterRoleBinding"
+	job                 K8sObjectName = "Job"
+	cronJob             K8sObjectName = "CronJob"
 )
 
 type InternalStore struct {
 	ObjectNameKind map[string]string
+	// ManagedKinds holds the kinds reconciled by the builder, orphans are only
+	// collected for these kinds.
+	ManagedKinds map[string]bool
+	// Kinds holds the list types registered by this store only, they take precedence over
+	// the kinds of the registry.
+	Kinds map[string]func() client.ObjectList
+	// phaseKinds collects the kinds managed while ReconcileAll runs a phase.
+	phaseKinds map[string]bool
 	CommonBuilder
 }
 
@@ -30,6 +57,7 @@ func NewStore(
 ) *InternalStore {
 	return &InternalStore{
 		ObjectNameKind: make(map[string]string),
+		ManagedKinds:   make(map[string]bool),
 		CommonBuilder: CommonBuilder{
 			Client: client,
 			Labels: labels,
@@ -47,74 +75,159 @@ func ToNewBuilderStore(builder InternalStore) func(*Builder) {
 	}
 }
 
-func (s *Builder) Put(key, value string) {
-	if _, isKeyExists := s.Store.ObjectNameKind[key]; isKeyExists {
+// Put records an object by name and kind as desired, so it is kept by ReconcileStore.
+func (s *Builder) Put(name, kind string) {
+	if s.Store.ObjectNameKind == nil {
+		s.Store.ObjectNameKind = make(map[string]string)
+	}
+	s.manageKind(kind)
+
+	if _, isKeyExists := s.Store.ObjectNameKind[storeKey(name, kind)]; isKeyExists {
 		return
 	} else {
-		s.Store.ObjectNameKind[key] = value
+		s.Store.ObjectNameKind[storeKey(name, kind)] = kind
 	}
 }
 
-func (s *Builder) Exists(key string) bool {
-	if _, isKeyExists := s.Store.ObjectNameKind[key]; isKeyExists {
+func (s *Builder) Exists(name, kind string) bool {
+	if _, isKeyExists := s.Store.ObjectNameKind[storeKey(name, kind)]; isKeyExists {
 		return true
 	}
 	return false
 }
 
+// manageKind marks a kind as reconciled by the builder, even when no object of the kind
+// is desired, so that every orphan of that kind is collected.
+func (s *Builder) manageKind(kind string) {
+	if s.Store.ManagedKinds == nil {
+		s.Store.ManagedKinds = make(map[string]bool)
+	}
+	s.Store.ManagedKinds[kind] = true
+	if s.Store.phaseKinds != nil {
+		s.Store.phaseKinds[kind] = true
+	}
+}
+
+// registerKind registers the list type of a kind for this store and marks the kind as managed.
+func (s *Builder) registerKind(kind string, newList func() client.ObjectList) {
+	if s.Store.Kinds == nil {
+		s.Store.Kinds = make(map[string]func() client.ObjectList)
+	}
+	s.Store.Kinds[kind] = newList
+	s.manageKind(kind)
+}
+
+// newUnstructuredList returns the list type used to garbage collect objects of a kind.
+func newUnstructuredList(gvk schema.GroupVersionKind) func() client.ObjectList {
+	return func() client.ObjectList {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		return list
+	}
+}
+
+func storeKey(name, kind string) string { return kind + "/" + name }
+
+// ReconcileStore deletes the objects of every managed kind which carry the store labels,
+// are controlled by the custom resource and are not desired anymore.
 func (s *Builder) ReconcileStore() error {
+	return s.reconcileStore().Err()
+}
 
-	for _, kind := range s.Store.ObjectNameKind {
-		switch kind {
-		case string(deployment):
-			s.Store.CommonBuilder.ObjectList = &v1.DeploymentList{}
-			list, err := s.Store.List(s.Context.Context, s.Recorder)
-			if err != nil {
-				return err
-			}
-			for _, deployment := range list.(*v1.DeploymentList).Items {
-				if !s.Exists(deployment.GetName()) {
-					s.Store.CommonBuilder.DesiredState = &deployment
-
-					_, err := s.Store.Delete(s.Context.Context, s.Recorder)
-					if err != nil {
-						return err
-					}
-				}
+func (s *Builder) reconcileStore() Result {
+	return s.reconcileStoreExcept(nil)
+}
+
+// reconcileStoreExcept garbage collects every managed kind besides the held ones.
+func (s *Builder) reconcileStoreExcept(held map[string]bool) Result {
+
+	var result Result
+
+	kinds := make([]string, 0, len(s.Store.ManagedKinds))
+	for kind := range s.Store.ManagedKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		objectList, ok := s.newStoreList(kind)
+		if !ok || held[kind] {
+			continue
+		}
+
+		s.Store.CommonBuilder.ObjectList = objectList
+		list, err := s.Store.List(s.Context.Context, s.Recorder)
+		// the kind is not served by the cluster, so there is nothing to collect
+		if meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			result.add(kind, "", controllerutil.OperationResultNone, err)
+			continue
+		}
+
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			result.add(kind, "", controllerutil.OperationResultNone, err)
+			continue
+		}
+
+		for _, obj := range objs {
+			object, ok := obj.(client.Object)
+			if !ok {
+				continue
 			}
-		case string(configMap):
-			s.Store.CommonBuilder.ObjectList = &corev1.ConfigMapList{}
-			list, err := s.Store.List(s.Context.Context, s.Recorder)
+
+			orphan, err := s.isOrphan(object, kind)
 			if err != nil {
-				return err
-			}
-			for _, cm := range list.(*corev1.ConfigMapList).Items {
-				if !s.Exists(cm.GetName()) {
-					s.Store.CommonBuilder.DesiredState = &cm
-					_, err := s.Store.Delete(s.Context.Context, s.Recorder)
-					if err != nil {
-						return err
-					}
-				}
+				result.add(kind, object.GetName(), controllerutil.OperationResultNone, err)
+				continue
 			}
-		case string(svc):
-			s.Store.CommonBuilder.ObjectList = &corev1.ServiceList{}
-			list, err := s.Store.List(s.Context.Context, s.Recorder)
-			if err != nil {
-				return err
+			if !orphan {
+				continue
 			}
-			for _, svc := range list.(*corev1.ServiceList).Items {
-				if !s.Exists(svc.GetName()) {
-					s.Store.CommonBuilder.DesiredState = &svc
-					_, err := s.Store.Delete(s.Context.Context, s.Recorder)
-					if err != nil {
-						return err
-					}
+
+			if claim, ok := object.(*corev1.PersistentVolumeClaim); ok {
+				if _, err := s.deletePvcWithPolicy(claim); err != nil {
+					result.add(kind, object.GetName(), controllerutil.OperationResultNone, err)
 				}
+				continue
+			}
+
+			store := s.Store.CommonBuilder
+			store.DesiredState = object
+			// jobs orphan their pods unless the propagation policy is set
+			if kind == string(job) {
+				background := metav1.DeletePropagationBackground
+				store.DeletePropagation = &background
 			}
+			operation, err := store.Delete(s.Context.Context, s.Recorder)
+			result.add(kind, object.GetName(), operation, err)
 		}
+	}
 
+	return result
+}
+
+func (s *Builder) isOrphan(obj client.Object, kind string) (bool, error) {
+	if claim, ok := obj.(*corev1.PersistentVolumeClaim); ok {
+		orphaned, err := s.isOrphanedClaimTemplatePvc(claim)
+		if err != nil || orphaned {
+			return orphaned, err
+		}
 	}
+	return !s.Exists(obj.GetName(), kind) && s.isOwnedByCr(obj), nil
+}
 
-	return nil
+// isOwnedByCr guards garbage collection against objects which only share the store labels,
+// such as pvcs created by a statefulset from its volume claim templates. Cluster scoped objects
+// are owned through the owner uid label instead of an owner reference.
+func (s *Builder) isOwnedByCr(obj client.Object) bool {
+	if s.Store.CrObject == nil {
+		return false
+	}
+	if obj.GetNamespace() == "" {
+		uid := obj.GetLabels()[ownerUIDLabel]
+		return uid != "" && uid == string(s.Store.CrObject.GetUID())
+	}
+	return metav1.IsControlledBy(obj, s.Store.CrObject)
 }
@@ -0,0 +1,97 @@
+package builder
+
+import (
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestExists(t *testing.T) {
+
+	b := NewBuilder()
+	b.Put("druid", string(configMap))
+
+	if !b.Exists("druid", string(configMap)) {
+		t.Error("Exists() = false for a put object")
+	}
+	if b.Exists("druid", string(deployment)) {
+		t.Error("Exists() = true for another kind with the same name")
+	}
+	if !b.Store.ManagedKinds[string(configMap)] {
+		t.Error("Put() did not manage the kind")
+	}
+}
+
+func TestReconcileStoreKeepsNodeTypes(t *testing.T) {
+
+	cr := newTestCr()
+
+	unowned := newTestDeployment(cr, "unowned")
+	unowned.OwnerReferences = nil
+
+	tests := []struct {
+		name     string
+		existing []client.Object
+		rollout  bool
+		kept     []client.Object
+		deleted  []client.Object
+	}{
+		{
+			name: "node types are created",
+		},
+		{
+			name:     "update of the first node type stops the rollout",
+			existing: []client.Object{newTestDeployment(cr, "first"), newTestDeployment(cr, "second")},
+			rollout:  true,
+		},
+		{
+			name:     "orphans of a managed kind are collected",
+			existing: []client.Object{newTestDeployment(cr, "removed"), unowned},
+			kept:     []client.Object{unowned},
+			deleted:  []client.Object{newTestDeployment(cr, "removed")},
+		},
+		{
+			name:     "objects are kept by name and kind",
+			existing: []client.Object{newTestStatefulSet(cr, "first")},
+			deleted:  []client.Object{newTestStatefulSet(cr, "first")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			c := newTestClient(append([]client.Object{cr.DeepCopy()}, tt.existing...)...)
+			b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder(), ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{
+				newTestNode(c, cr, "first", "Deployment"),
+				newTestNode(c, cr, "second", "Deployment"),
+			}))
+
+			result, err := b.ReconcileDeployOrSts()
+			if err != nil {
+				t.Fatalf("ReconcileDeployOrSts() error = %v", err)
+			}
+			if result.RolloutInProgress != tt.rollout {
+				t.Errorf("RolloutInProgress = %v, want %v", result.RolloutInProgress, tt.rollout)
+			}
+			if err := b.ReconcileStore(); err != nil {
+				t.Fatalf("ReconcileStore() error = %v", err)
+			}
+
+			for _, name := range []string{"first", "second"} {
+				if !exists(c, newTestDeployment(cr, name)) {
+					t.Errorf("node type [%s] was collected", name)
+				}
+			}
+			for _, obj := range tt.kept {
+				if !exists(c, obj) {
+					t.Errorf("[%s] was collected", obj.GetName())
+				}
+			}
+			for _, obj := range tt.deleted {
+				if exists(c, obj) {
+					t.Errorf("[%s] was not collected", obj.GetName())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package builder
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testNamespace = "default"
+
+var testLabels = map[string]string{"app": "test"}
+
+// newTestCr returns the custom resource the tests reconcile, a configmap stands in for it.
+func newTestCr() *v1.ConfigMap {
+	return &v1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "cr", Namespace: testNamespace, UID: "cr-uid", Generation: 1},
+	}
+}
+
+func newTestClient(objs ...client.Object) client.Client {
+	return fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build()
+}
+
+func newTestRecorder() BuilderRecorder {
+	return BuilderRecorder{Recorder: record.NewFakeRecorder(100), ControllerName: "Test"}
+}
+
+func newTestBuilder(c client.Client, cr client.Object, recorder BuilderRecorder, opts ...ToBuilder) *Builder {
+	store := NewStore(c, testLabels, testNamespace, cr)
+	return NewBuilder(append([]ToBuilder{
+		ToNewBuilderStore(*store),
+		ToNewBuilderContext(BuilderContext{Context: context.Background()}),
+		ToNewBuilderRecorder(recorder),
+	}, opts...)...)
+}
+
+func newTestOwnerRef(cr client.Object) metav1.OwnerReference {
+	return metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: cr.GetName(), UID: cr.GetUID()}
+}
+
+func newTestCommonBuilder(c client.Client, cr client.Object, name string) CommonBuilder {
+	return CommonBuilder{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: testLabels},
+		Client:     c,
+		OwnerRef:   newTestOwnerRef(cr),
+		CrObject:   cr,
+	}
+}
+
+func newTestNode(c client.Client, cr client.Object, name, kind string) BuilderDeploymentStatefulSet {
+	return BuilderDeploymentStatefulSet{
+		Replicas:      1,
+		Labels:        testLabels,
+		Kind:          kind,
+		PodSpec:       &v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "app:1"}}},
+		CommonBuilder: newTestCommonBuilder(c, cr, name),
+	}
+}
+
+// newTestObjectMeta returns the metadata of an object left in the cluster by an earlier reconcile.
+func newTestObjectMeta(cr client.Object, name string) metav1.ObjectMeta {
+	trueVar := true
+	ownerRef := newTestOwnerRef(cr)
+	ownerRef.Controller = &trueVar
+	return metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       testNamespace,
+		Labels:          testLabels,
+		OwnerReferences: []metav1.OwnerReference{ownerRef},
+	}
+}
+
+func newTestDeployment(cr client.Object, name string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: newTestObjectMeta(cr, name),
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: v1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: testLabels}},
+		},
+	}
+}
+
+func newTestStatefulSet(cr client.Object, name string) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: newTestObjectMeta(cr, name),
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: testLabels},
+			Template: v1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: testLabels}},
+		},
+	}
+}
+
+func newTestConfigMap(name string, data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: testLabels},
+		Data:       data,
+	}
+}
+
+// exists reports whether obj is still in the cluster, obj is refreshed with the live state.
+func exists(c client.Client, obj client.Object) bool {
+	return c.Get(context.Background(), client.ObjectKeyFromObject(obj), obj) == nil
+}
+
+func objectKey(name string) client.ObjectKey {
+	return client.ObjectKey{Name: name, Namespace: testNamespace}
+}
@@ -0,0 +1,176 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// ResourceBuilder builds an object of the concrete type T, its hooks get typed access to the
+// desired and live objects. The kind is resolved from T and the scheme of the client, or from the
+// client-go scheme when the builder has no client yet.
+type ResourceBuilder[T client.Object] struct {
+	// Desired returns the desired state of the object.
+	Desired func() (T, error)
+	// Mutate adjusts the desired object right before it is written, current is nil when the
+	// object is created. Changes made by it are not part of the hash.
+	Mutate func(desired, current T)
+	// Ready reports whether the live object is ready, defaults to ready once it is written.
+	Ready          func(current T) (bool, error)
+	ReconcilePhase Phase
+	ReconcileOrder int
+	CommonBuilder
+
+	gvk  schema.GroupVersionKind
+	list client.ObjectList
+}
+
+// NewResourceBuilder returns a ResourceBuilder for T, it fails when T is not known to the scheme
+// of the client.
+func NewResourceBuilder[T client.Object](common CommonBuilder) (*ResourceBuilder[T], error) {
+	b := &ResourceBuilder[T]{CommonBuilder: common}
+	if err := b.resolve(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// resolve looks up the kind of T and its list type, it is a no-op once they are known.
+func (b *ResourceBuilder[T]) resolve() error {
+
+	if b.list != nil {
+		return nil
+	}
+
+	// T may be an interface or a non pointer type, neither can be instantiated
+	var zero T
+	t := reflect.TypeOf(zero)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return fmt.Errorf("type [%T] is not an object", zero)
+	}
+	obj, ok := reflect.New(t.Elem()).Interface().(client.Object)
+	if !ok {
+		return fmt.Errorf("type [%T] is not an object", zero)
+	}
+
+	gvk, err := apiutil.GVKForObject(obj, b.scheme())
+	if err != nil {
+		return err
+	}
+	return b.setKind(gvk)
+}
+
+func (b *ResourceBuilder[T]) setKind(gvk schema.GroupVersionKind) error {
+	list, err := newListForKind(b.scheme(), gvk)
+	if err != nil {
+		return err
+	}
+	b.gvk = gvk
+	b.list = list
+	return nil
+}
+
+func (b *ResourceBuilder[T]) scheme() *runtime.Scheme {
+	if b.Client != nil {
+		return b.Client.Scheme()
+	}
+	return scheme.Scheme
+}
+
+// MakeDesired returns the desired object with its GroupVersionKind set from the scheme.
+func (b *ResourceBuilder[T]) MakeDesired() (client.Object, error) {
+
+	if b.Desired == nil {
+		return nil, fmt.Errorf("resource [%s] has no desired state", b.ObjectMeta.Name)
+	}
+
+	desired, err := b.Desired()
+	if err != nil {
+		return nil, err
+	}
+
+	// unstructured objects carry their kind, it can only be resolved from the desired object
+	gvk, err := apiutil.GVKForObject(desired, b.scheme())
+	if err != nil {
+		return nil, err
+	}
+	desired.GetObjectKind().SetGroupVersionKind(gvk)
+
+	if gvk != b.gvk {
+		if err := b.setKind(gvk); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.Mutate != nil {
+		b.beforeWrite = func(desired, current client.Object) {
+			var live T
+			if current != nil {
+				live, _ = current.(T)
+			}
+			if typed, ok := desired.(T); ok {
+				b.Mutate(typed, live)
+			}
+		}
+	}
+
+	return desired, nil
+}
+
+// Kind is the kind of T as the built-in builders name it, so the objects of a built-in kind are
+// kept and collected by the same store entries. It is empty when T is not known to the scheme, or
+// is unstructured and MakeDesired did not run yet.
+func (b *ResourceBuilder[T]) Kind() string {
+	if err := b.resolve(); err != nil {
+		return ""
+	}
+	return b.gvk.Kind
+}
+
+// NewList returns an empty list of T, or an empty unstructured list when its kind is not known.
+func (b *ResourceBuilder[T]) NewList() client.ObjectList {
+	if err := b.resolve(); err != nil {
+		return &unstructured.UnstructuredList{}
+	}
+	return b.list.DeepCopyObject().(client.ObjectList)
+}
+
+func (b *ResourceBuilder[T]) IsReady(obj client.Object) (bool, error) {
+	current, ok := obj.(T)
+	if !ok {
+		return false, fmt.Errorf("resource [%s] is a %s, not a %s", obj.GetName(), detectType(obj, b.scheme()), b.gvk.Kind)
+	}
+	if b.Ready == nil {
+		return true, nil
+	}
+	return b.Ready(current)
+}
+
+func (b *ResourceBuilder[T]) Phase() Phase { return b.ReconcilePhase }
+
+func (b *ResourceBuilder[T]) Order() int { return b.ReconcileOrder }
+
+// newListForKind returns an empty list of a kind, from the scheme or as an unstructured list.
+func newListForKind(s *runtime.Scheme, gvk schema.GroupVersionKind) (client.ObjectList, error) {
+
+	listGVK := gvk.GroupVersion().WithKind(gvk.Kind + "List")
+	if !s.Recognizes(listGVK) {
+		return newUnstructuredList(gvk)(), nil
+	}
+
+	obj, err := s.New(listGVK)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := obj.(client.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("kind [%s] is not a list", listGVK.Kind)
+	}
+	return list, nil
+}
@@ -0,0 +1,112 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestResourceBuilderKind(t *testing.T) {
+
+	c := newTestClient()
+
+	tests := []struct {
+		name     string
+		resource ResourceKind
+		kind     string
+		list     client.ObjectList
+	}{
+		{
+			name:     "resolved from the type",
+			resource: &ResourceBuilder[*v1.Secret]{},
+			kind:     "Secret",
+			list:     &v1.SecretList{},
+		},
+		{
+			name:     "resolved from the client scheme",
+			resource: &ResourceBuilder[*v1.ConfigMap]{CommonBuilder: CommonBuilder{Client: c}},
+			kind:     "ConfigMap",
+			list:     &v1.ConfigMapList{},
+		},
+		{
+			name:     "built-in kinds are not group qualified",
+			resource: &ResourceBuilder[*appsv1.Deployment]{},
+			kind:     "Deployment",
+			list:     &appsv1.DeploymentList{},
+		},
+		{
+			name:     "interface type",
+			resource: &ResourceBuilder[client.Object]{},
+			list:     &unstructured.UnstructuredList{},
+		},
+		{
+			name:     "unstructured before MakeDesired",
+			resource: &ResourceBuilder[*unstructured.Unstructured]{},
+			list:     &unstructured.UnstructuredList{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if kind := tt.resource.Kind(); kind != tt.kind {
+				t.Errorf("Kind() = %q, want %q", kind, tt.kind)
+			}
+			if list := tt.resource.NewList(); reflect.TypeOf(list) != reflect.TypeOf(tt.list) {
+				t.Errorf("NewList() = %T, want %T", list, tt.list)
+			}
+		})
+	}
+}
+
+func TestRegisterResourceKindRejectsUnnamedKinds(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RegisterResourceKind() did not panic")
+		}
+	}()
+	RegisterResourceKind(&ResourceBuilder[*unstructured.Unstructured]{})
+}
+
+func TestNewResourceBuilderRejectsInterfaces(t *testing.T) {
+	if _, err := NewResourceBuilder[client.Object](CommonBuilder{}); err == nil {
+		t.Errorf("NewResourceBuilder() error = nil, want an error for an interface type")
+	}
+}
+
+func TestResourceBuilderSharesBuiltinKinds(t *testing.T) {
+	cr := newTestCr()
+	c := newTestClient()
+
+	typed, err := NewResourceBuilder[*appsv1.Deployment](newTestCommonBuilder(c, cr, "sidecar"))
+	if err != nil {
+		t.Fatalf("NewResourceBuilder() error = %v", err)
+	}
+	typed.ReconcilePhase = PhaseWorkloads
+	typed.Desired = func() (*appsv1.Deployment, error) {
+		deploy := newTestDeployment(cr, "sidecar")
+		deploy.Spec.Template.Spec.Containers = []v1.Container{{Name: "sidecar", Image: "sidecar:1"}}
+		return deploy, nil
+	}
+
+	b := newTestBuilder(c, cr, newTestRecorder(),
+		ToNewBuilderDeploymentStatefulSet([]BuilderDeploymentStatefulSet{newTestNode(c, cr, "broker", "Deployment")}),
+		ToNewBuilderResources([]Resource{typed}),
+	)
+
+	// every reconcile garbage collects, neither deployment may collect the other one
+	for i := 0; i < 2; i++ {
+		if _, err := b.ReconcileAll(); err != nil {
+			t.Fatalf("reconcile %d: ReconcileAll() error = %v", i, err)
+		}
+		for _, name := range []string{"broker", "sidecar"} {
+			if !exists(c, newTestDeployment(cr, name)) {
+				t.Fatalf("reconcile %d: deployment %s was garbage collected", i, name)
+			}
+		}
+	}
+}
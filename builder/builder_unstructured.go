@@ -0,0 +1,120 @@
+package builder
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// BuilderUnstructured manages an object of any kind, typically the custom resources of third
+// party operators which the runtime has no types for.
+type BuilderUnstructured struct {
+	GroupVersionKind schema.GroupVersionKind
+	// Object is the body of the object, name, namespace, labels and annotations set on
+	// ObjectMeta take precedence over the ones of the body.
+	Object *unstructured.Unstructured
+	CommonBuilder
+}
+
+func ToNewBuilderUnstructured(builder []BuilderUnstructured) func(*Builder) {
+	return func(s *Builder) {
+		s.Unstructured = builder
+	}
+}
+
+// ToNewBuilderUnstructuredKinds declares the kinds managed through BuilderUnstructured, their
+// objects are garbage collected even once the builder holds no object of the kind anymore.
+func ToNewBuilderUnstructuredKinds(kinds []schema.GroupVersionKind) func(*Builder) {
+	return func(s *Builder) {
+		s.UnstructuredKinds = kinds
+	}
+}
+
+// ReconcileUnstructured reconciles the unstructured objects, objects whose kind is not served by
+// the cluster are skipped with a warning event. The kinds of the objects and the declared
+// UnstructuredKinds are garbage collected.
+func (s *Builder) ReconcileUnstructured() (Result, error) {
+
+	var result Result
+
+	for _, gvk := range s.UnstructuredKinds {
+		s.registerKind(gvk.GroupKind().String(), newUnstructuredList(gvk))
+	}
+	for _, u := range s.Unstructured {
+		s.registerKind(u.GroupVersionKind.GroupKind().String(), newUnstructuredList(u.GroupVersionKind))
+	}
+
+	for _, u := range s.Unstructured {
+
+		gvk := u.GroupVersionKind
+		kind := gvk.GroupKind().String()
+
+		if _, err := u.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			if meta.IsNoMatchError(err) {
+				s.Recorder.GenericEvent(
+					u.CrObject,
+					v1.EventTypeWarning,
+					fmt.Sprintf("Name [%s], Namespace [%s], Kind [%s], kind is not installed", u.ObjectMeta.Name, u.ObjectMeta.Namespace, gvk.String()),
+					s.Recorder.ControllerName+"SkipObject",
+				)
+				continue
+			}
+			result.add(kind, u.ObjectMeta.Name, controllerutil.OperationResultNone, err)
+			continue
+		}
+
+		makeObj := u.makeUnstructured()
+
+		s.Put(makeObj.GetName(), kind)
+
+		u.DesiredState = makeObj
+		currentState := &unstructured.Unstructured{}
+		currentState.SetGroupVersionKind(gvk)
+		u.CurrentState = currentState
+
+		operation, err := u.CreateOrUpdate(s.Context.Context, s.Recorder)
+		result.add(kind, makeObj.GetName(), operation, err)
+	}
+
+	return result, result.Err()
+}
+
+func (b *BuilderUnstructured) makeUnstructured() *unstructured.Unstructured {
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if b.Object != nil {
+		obj = b.Object.DeepCopy()
+	}
+	obj.SetGroupVersionKind(b.GroupVersionKind)
+
+	objectMeta := b.ObjectMeta.DeepCopy()
+	if objectMeta.Name != "" {
+		obj.SetName(objectMeta.Name)
+	}
+	if objectMeta.Namespace != "" {
+		obj.SetNamespace(objectMeta.Namespace)
+	}
+	if len(objectMeta.Labels) > 0 {
+		obj.SetLabels(mergeStringMaps(obj.GetLabels(), objectMeta.Labels))
+	}
+	if len(objectMeta.Annotations) > 0 {
+		obj.SetAnnotations(mergeStringMaps(obj.GetAnnotations(), objectMeta.Annotations))
+	}
+
+	return obj
+}
+
+func mergeStringMaps(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,108 @@
+package builder
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var testWidgetGvk = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+// newTestUnstructuredClient returns a client whose rest mapper serves the given kinds only.
+func newTestUnstructuredClient(gvks []schema.GroupVersionKind, objs ...client.Object) client.Client {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range gvks {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).WithObjects(objs...).Build()
+}
+
+func newTestWidget(cr client.Object, name string) *unstructured.Unstructured {
+	widget := &unstructured.Unstructured{}
+	widget.SetGroupVersionKind(testWidgetGvk)
+	objectMeta := newTestObjectMeta(cr, name)
+	widget.SetName(objectMeta.Name)
+	widget.SetNamespace(objectMeta.Namespace)
+	widget.SetLabels(objectMeta.Labels)
+	widget.SetOwnerReferences(objectMeta.OwnerReferences)
+	return widget
+}
+
+func TestReconcileUnstructured(t *testing.T) {
+	cr := newTestCr()
+	orphan := newTestWidget(cr, "old-widget")
+	c := newTestUnstructuredClient([]schema.GroupVersionKind{testWidgetGvk}, orphan)
+
+	body := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "ignored"},
+		"spec":     map[string]interface{}{"size": int64(3)},
+	}}
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderUnstructured([]BuilderUnstructured{{
+		GroupVersionKind: testWidgetGvk,
+		Object:           body,
+		CommonBuilder:    newTestCommonBuilder(c, cr, "widget"),
+	}}))
+
+	if _, err := b.ReconcileUnstructured(); err != nil {
+		t.Fatalf("ReconcileUnstructured() error = %v", err)
+	}
+	if err := b.ReconcileStore(); err != nil {
+		t.Fatalf("ReconcileStore() error = %v", err)
+	}
+
+	widget := newTestWidget(cr, "widget")
+	if !exists(c, widget) {
+		t.Fatalf("widget was not created or was garbage collected")
+	}
+	if size, _, _ := unstructured.NestedInt64(widget.Object, "spec", "size"); size != 3 {
+		t.Errorf("spec.size = %d, want 3", size)
+	}
+	if exists(c, orphan) {
+		t.Errorf("orphaned widget old-widget was not garbage collected")
+	}
+}
+
+func TestReconcileUnstructuredKindsWithoutObjects(t *testing.T) {
+	cr := newTestCr()
+	orphan := newTestWidget(cr, "old-widget")
+	c := newTestUnstructuredClient([]schema.GroupVersionKind{testWidgetGvk}, orphan)
+
+	b := newTestBuilder(c, cr, newTestRecorder(), ToNewBuilderUnstructuredKinds([]schema.GroupVersionKind{testWidgetGvk}))
+
+	if _, err := b.ReconcileUnstructured(); err != nil {
+		t.Fatalf("ReconcileUnstructured() error = %v", err)
+	}
+	if err := b.ReconcileStore(); err != nil {
+		t.Fatalf("ReconcileStore() error = %v", err)
+	}
+
+	if exists(c, orphan) {
+		t.Errorf("orphaned widget old-widget was not garbage collected")
+	}
+}
+
+func TestReconcileUnstructuredSkipsUnservedKinds(t *testing.T) {
+	cr := newTestCr()
+	c := newTestUnstructuredClient(nil)
+	recorder := newTestRecorder()
+
+	b := newTestBuilder(c, cr, recorder, ToNewBuilderUnstructured([]BuilderUnstructured{{
+		GroupVersionKind: testWidgetGvk,
+		CommonBuilder:    newTestCommonBuilder(c, cr, "widget"),
+	}}))
+
+	if _, err := b.ReconcileUnstructured(); err != nil {
+		t.Fatalf("ReconcileUnstructured() error = %v", err)
+	}
+	if err := b.ReconcileStore(); err != nil {
+		t.Fatalf("ReconcileStore() error = %v", err)
+	}
+	if !hasEvent(recorder, "SkipObject") {
+		t.Errorf("no SkipObject event recorded for the unserved kind")
+	}
+}
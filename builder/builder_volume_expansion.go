@@ -0,0 +1,219 @@
+package builder
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	volumeExpansionCondition      = "VolumeExpansion"
+	defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+)
+
+// expandVolumeClaimTemplates resizes the pvcs of a statefulset whose volume claim templates request
+// more storage than the live statefulset. Volume claim templates are immutable, so once every pvc is
+// patched the statefulset is deleted with orphan propagation, leaving its pods running, and is
+// recreated with the new templates by a following reconcile. It returns true while the statefulset
+// is being recreated.
+func (s *Builder) expandVolumeClaimTemplates(statefulset BuilderDeploymentStatefulSet, desired *appsv1.StatefulSet) (bool, error) {
+
+	current := &appsv1.StatefulSet{}
+	if err := statefulset.Client.Get(s.Context.Context, *namespacedName(desired.GetName(), desired.GetNamespace()), current); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// orphan deletion is still in progress
+	if current.GetDeletionTimestamp() != nil {
+		return true, nil
+	}
+
+	var expanded []v1.PersistentVolumeClaim
+	for _, template := range desired.Spec.VolumeClaimTemplates {
+		currentTemplate := findClaimTemplate(current.Spec.VolumeClaimTemplates, template.GetName())
+		if currentTemplate == nil {
+			continue
+		}
+
+		desiredSize := template.Spec.Resources.Requests[v1.ResourceStorage]
+		currentSize := currentTemplate.Spec.Resources.Requests[v1.ResourceStorage]
+
+		switch desiredSize.Cmp(currentSize) {
+		case 1:
+			// the storage class is immutable, the live one decides if expansion is allowed
+			template.Spec.StorageClassName = currentTemplate.Spec.StorageClassName
+			expanded = append(expanded, template)
+		case -1:
+			err := fmt.Errorf("volume claim template [%s] of statefulset [%s] cannot shrink from [%s] to [%s]", template.GetName(), current.GetName(), currentSize.String(), desiredSize.String())
+			s.Recorder.updateEvent(statefulset.CrObject, current, err)
+			return false, err
+		}
+	}
+
+	if len(expanded) == 0 {
+		return false, s.reportVolumeExpansion(statefulset, current)
+	}
+
+	for _, template := range expanded {
+		if err := s.isVolumeExpansionAllowed(statefulset, template.Spec.StorageClassName); err != nil {
+			s.Recorder.updateEvent(statefulset.CrObject, current, err)
+			return false, err
+		}
+	}
+
+	for _, template := range expanded {
+		claims, err := s.claimTemplatePvcs(statefulset, current, template.GetName())
+		if err != nil {
+			return false, err
+		}
+
+		for _, claim := range claims {
+			desiredSize := template.Spec.Resources.Requests[v1.ResourceStorage]
+			currentSize := claim.Spec.Resources.Requests[v1.ResourceStorage]
+			if desiredSize.Cmp(currentSize) <= 0 {
+				continue
+			}
+
+			patch := client.MergeFrom(claim.DeepCopy())
+			if claim.Spec.Resources.Requests == nil {
+				claim.Spec.Resources.Requests = v1.ResourceList{}
+			}
+			claim.Spec.Resources.Requests[v1.ResourceStorage] = desiredSize
+			if err := statefulset.Client.Patch(s.Context.Context, claim, patch); err != nil {
+				s.Recorder.updateEvent(statefulset.CrObject, claim, err)
+				return false, err
+			}
+			s.Recorder.volumeExpansionEvent(statefulset.CrObject, claim, fmt.Sprintf("resized from [%s] to [%s]", currentSize.String(), desiredSize.String()))
+		}
+	}
+
+	if err := statefulset.orphanDelete(s.Context.Context, s.Recorder, current); err != nil {
+		return false, err
+	}
+	s.Recorder.volumeExpansionEvent(statefulset.CrObject, current, "deleted with orphan propagation to apply the expanded volume claim templates")
+
+	s.setCondition(
+		volumeExpansionCondition+"."+current.GetName(),
+		metav1.ConditionTrue,
+		"Resizing",
+		fmt.Sprintf("pvcs of statefulset [%s] are being resized, statefulset is recreated", current.GetName()),
+	)
+
+	return true, nil
+}
+
+// reportVolumeExpansion reports the pvcs of the statefulset which still wait for their resize.
+func (s *Builder) reportVolumeExpansion(statefulset BuilderDeploymentStatefulSet, current *appsv1.StatefulSet) error {
+
+	if len(current.Spec.VolumeClaimTemplates) == 0 {
+		return nil
+	}
+
+	pending := 0
+	for _, template := range current.Spec.VolumeClaimTemplates {
+		claims, err := s.claimTemplatePvcs(statefulset, current, template.GetName())
+		if err != nil {
+			return err
+		}
+		for _, claim := range claims {
+			requested := claim.Spec.Resources.Requests[v1.ResourceStorage]
+			capacity := claim.Status.Capacity[v1.ResourceStorage]
+			if capacity.Cmp(requested) < 0 {
+				pending++
+			}
+		}
+	}
+
+	if pending > 0 {
+		s.setCondition(
+			volumeExpansionCondition+"."+current.GetName(),
+			metav1.ConditionTrue,
+			"FileSystemResizePending",
+			fmt.Sprintf("[%d] pvcs of statefulset [%s] wait for their resize", pending, current.GetName()),
+		)
+	} else {
+		s.setCondition(
+			volumeExpansionCondition+"."+current.GetName(),
+			metav1.ConditionFalse,
+			"Completed",
+			fmt.Sprintf("pvcs of statefulset [%s] match their volume claim templates", current.GetName()),
+		)
+	}
+
+	return nil
+}
+
+// claimTemplatePvcs returns the pvcs created for every ordinal of the statefulset from a volume claim template.
+func (s *Builder) claimTemplatePvcs(statefulset BuilderDeploymentStatefulSet, sts *appsv1.StatefulSet, template string) ([]*v1.PersistentVolumeClaim, error) {
+
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+
+	var claims []*v1.PersistentVolumeClaim
+	for ordinal := int32(0); ordinal < replicas; ordinal++ {
+		claim := &v1.PersistentVolumeClaim{}
+		name := fmt.Sprintf("%s-%s-%d", template, sts.GetName(), ordinal)
+		if err := statefulset.Client.Get(s.Context.Context, *namespacedName(name, sts.GetNamespace()), claim); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		claims = append(claims, claim)
+	}
+
+	return claims, nil
+}
+
+// isVolumeExpansionAllowed checks allowVolumeExpansion on the storage class, falling back to the
+// cluster default storage class when none is set.
+func (s *Builder) isVolumeExpansionAllowed(statefulset BuilderDeploymentStatefulSet, storageClassName *string) error {
+
+	var storageClass *storagev1.StorageClass
+
+	if storageClassName != nil && *storageClassName != "" {
+		storageClass = &storagev1.StorageClass{}
+		if err := statefulset.Client.Get(s.Context.Context, *namespacedName(*storageClassName, ""), storageClass); err != nil {
+			return err
+		}
+	} else {
+		storageClasses := &storagev1.StorageClassList{}
+		if err := statefulset.Client.List(s.Context.Context, storageClasses); err != nil {
+			return err
+		}
+		for i := range storageClasses.Items {
+			if storageClasses.Items[i].GetAnnotations()[defaultStorageClassAnnotation] == "true" {
+				storageClass = &storageClasses.Items[i]
+				break
+			}
+		}
+		if storageClass == nil {
+			return fmt.Errorf("no default storage class found to expand volumes")
+		}
+	}
+
+	if storageClass.AllowVolumeExpansion == nil || !*storageClass.AllowVolumeExpansion {
+		return fmt.Errorf("storage class [%s] does not allow volume expansion", storageClass.GetName())
+	}
+
+	return nil
+}
+
+func findClaimTemplate(templates []v1.PersistentVolumeClaim, name string) *v1.PersistentVolumeClaim {
+	for i := range templates {
+		if templates[i].GetName() == name {
+			return &templates[i]
+		}
+	}
+	return nil
+}
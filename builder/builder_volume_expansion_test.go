@@ -0,0 +1,137 @@
+package builder
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestClaimSpec(size, storageClass string) v1.PersistentVolumeClaimSpec {
+	return v1.PersistentVolumeClaimSpec{
+		StorageClassName: &storageClass,
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse(size)},
+		},
+	}
+}
+
+func newTestStorageClass(name string, expandable bool) *storagev1.StorageClass {
+	return &storagev1.StorageClass{
+		ObjectMeta:           metav1.ObjectMeta{Name: name},
+		Provisioner:          "test",
+		AllowVolumeExpansion: &expandable,
+	}
+}
+
+func TestExpandVolumeClaimTemplates(t *testing.T) {
+
+	cr := newTestCr()
+
+	tests := []struct {
+		name         string
+		desiredSize  string
+		expandable   bool
+		recreating   bool
+		wantErr      string
+		claimSize    string
+		conditionWhy string
+	}{
+		{
+			name:         "larger template resizes pvcs and recreates the statefulset",
+			desiredSize:  "2Gi",
+			expandable:   true,
+			recreating:   true,
+			claimSize:    "2Gi",
+			conditionWhy: "Resizing",
+		},
+		{
+			name:         "unchanged template",
+			desiredSize:  "1Gi",
+			expandable:   true,
+			claimSize:    "1Gi",
+			conditionWhy: "Completed",
+		},
+		{
+			name:        "storage class without expansion",
+			desiredSize: "2Gi",
+			wantErr:     "does not allow volume expansion",
+			claimSize:   "1Gi",
+		},
+		{
+			name:        "smaller template",
+			desiredSize: "512Mi",
+			expandable:  true,
+			wantErr:     "cannot shrink",
+			claimSize:   "1Gi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			replicas := int32(1)
+			live := newTestStatefulSet(cr, "data-node")
+			live.Spec.Replicas = &replicas
+			live.Spec.VolumeClaimTemplates = []v1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: "data"}, Spec: newTestClaimSpec("1Gi", "standard")},
+			}
+
+			claim := &v1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "data-data-node-0", Namespace: testNamespace},
+				Spec:       newTestClaimSpec("1Gi", "standard"),
+				Status: v1.PersistentVolumeClaimStatus{
+					Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+				},
+			}
+
+			c := newTestClient(live, claim, newTestStorageClass("standard", tt.expandable))
+			b := newTestBuilder(c, cr.DeepCopy(), newTestRecorder())
+
+			node := newTestNode(c, cr, "data-node", "Statefulset")
+			desired := live.DeepCopy()
+			desired.Spec.VolumeClaimTemplates[0].Spec = newTestClaimSpec(tt.desiredSize, "")
+
+			recreating, err := b.expandVolumeClaimTemplates(node, desired)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expandVolumeClaimTemplates() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("expandVolumeClaimTemplates() error = %v", err)
+			}
+			if recreating != tt.recreating {
+				t.Errorf("expandVolumeClaimTemplates() = %v, want %v", recreating, tt.recreating)
+			}
+
+			if deleted := !exists(c, &appsv1.StatefulSet{ObjectMeta: live.ObjectMeta}); deleted != tt.recreating {
+				t.Errorf("statefulset deleted = %v, want %v", deleted, tt.recreating)
+			}
+
+			resized := &v1.PersistentVolumeClaim{}
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(claim), resized); err != nil {
+				t.Fatal(err)
+			}
+			size := resized.Spec.Resources.Requests[v1.ResourceStorage]
+			if want := resource.MustParse(tt.claimSize); size.Cmp(want) != 0 {
+				t.Errorf("pvc size = %s, want %s", size.String(), tt.claimSize)
+			}
+
+			condition := meta.FindStatusCondition(b.Status.Conditions, volumeExpansionCondition+".data-node")
+			if tt.conditionWhy == "" {
+				if condition != nil {
+					t.Errorf("condition = %v, want none", condition.Reason)
+				}
+			} else if condition == nil || condition.Reason != tt.conditionWhy {
+				t.Errorf("condition = %v, want reason %s", condition, tt.conditionWhy)
+			}
+		})
+	}
+}
@@ -2,17 +2,29 @@ package reconciler
 
 import (
 	"github.com/datainfrahq/operator-runtime/builder"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 // ReconcileInterface holds all the methods to create operators
 type ReconcileInterface interface {
-	ReconcileConfigMap() (controllerutil.OperationResult, error)
-	ReconcileDeployOrSts() (controllerutil.OperationResult, error)
-	ReconcileStorage() (controllerutil.OperationResult, error)
-	ReconcileService() (controllerutil.OperationResult, error)
-	ReconcileNetworkPolicy() (controllerutil.OperationResult, error)
+	ReconcileConfigMap() (builder.Result, error)
+	ReconcileSecret() (builder.Result, error)
+	ReconcileServiceAccount() (builder.Result, error)
+	ReconcileRole() (builder.Result, error)
+	ReconcileRoleBinding() (builder.Result, error)
+	ReconcileDeployOrSts() (builder.Result, error)
+	ReconcilePodDisruptionBudget() (builder.Result, error)
+	ReconcileHPA() (builder.Result, error)
+	ReconcileJob() (builder.Result, error)
+	ReconcileCronJob() (builder.Result, error)
+	ReconcileStorage() (builder.Result, error)
+	ReconcileService() (builder.Result, error)
+	ReconcileNetworkPolicy() (builder.Result, error)
+	ReconcileIngress() (builder.Result, error)
+	ReconcileRoute() (builder.Result, error)
+	ReconcileUnstructured() (builder.Result, error)
+	ReconcileResources() (builder.Result, error)
 	ReconcileStore() error
+	ReconcileAll() (builder.Result, error)
 }
 
 var Reconciler ReconcileInterface = builder.NewBuilder()
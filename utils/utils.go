@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -91,3 +93,19 @@ func LookupReconcileTime(log logr.Logger) time.Duration {
 		return v
 	}
 }
+
+// IsPvcRetentionPolicySupported reports whether the statefulset persistentVolumeClaimRetentionPolicy
+// is enabled by default on the cluster, the StatefulSetAutoDeletePVC feature is beta from 1.27.
+func IsPvcRetentionPolicySupported(discoveryClient discovery.ServerVersionInterface) (bool, error) {
+	info, err := discoveryClient.ServerVersion()
+	if err != nil {
+		return false, err
+	}
+
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return false, err
+	}
+
+	return serverVersion.AtLeast(version.MustParseGeneric("1.27.0")), nil
+}